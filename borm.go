@@ -12,9 +12,12 @@ package borm
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"path"
 	"reflect"
 	"runtime"
@@ -38,9 +41,14 @@ const (
 	_limit
 	_onDuplicateKeyUpdate
 	_forceIndex
+	_union
+	_with
+	_lock
+	_optimizerHint
 
 	_andCondEx = iota
 	_orCondEx
+	_notCondEx
 )
 
 const (
@@ -60,14 +68,62 @@ type V map[string]interface{}
 // U - an alias string type for update to support `x=x+1`
 type U string
 
+// ErrStaleObject is returned by Update of a struct with a `version` field when no row has that version
+var ErrStaleObject = errors.New("borm: stale object, version changed")
+
 // Config .
 type Config struct {
 	Debug               bool
 	Reuse               bool // Enabled by default, provides 2-14x performance improvement
 	UseNameWhenTagEmpty bool
 	ToTimestamp         bool
+	Dialect             *Dialect            // MySQL if nil
+	AutoQualify         bool                // qualify unprefixed struct columns with the table name in Select
+	Clock               func() time.Time    // time.Now if nil, for autoCreateTime and autoUpdateTime fields
+	Unscoped            bool                // no soft-delete scoping
+	Naming              func(string) string // maps the names of untagged fields to columns with UseNameWhenTagEmpty, as is if nil, set with Naming
+
+	softDelete *softDeleteCol
+	keyed      *Dialect // the dialect dialectKey is the key of
+	dialectKey string
+}
+
+// Dialect describes the SQL features supported by the database behind a table, not to be changed once used
+type Dialect struct {
+	Name            string
+	RowValues       bool // `(a,b) in ((?,?),(?,?))`, InTuple falls back to or-ed ands without it
+	ForUpdate       bool // `for update`
+	ForShare        bool // `for share`
+	LockInShareMode bool // `lock in share mode`, used for ForShare without `for share` and vice versa
+	LockWait        bool // `nowait` and `skip locked` after `for update` or `for share`
+	Returning       bool // `insert ... returning id`, used to fill `auto` fields back
+	DefaultValues   bool // `default` in insert rows, for the zero `omitempty` fields of a batch
+}
+
+// key is a compact form of d for reuse keys
+func (d *Dialect) key() string {
+	var sb strings.Builder
+	sb.WriteString(d.Name)
+	sb.WriteString(":")
+	for _, f := range []bool{d.RowValues, d.ForUpdate, d.ForShare, d.LockInShareMode, d.LockWait, d.Returning, d.DefaultValues} {
+		if f {
+			sb.WriteString("1")
+		} else {
+			sb.WriteString("0")
+		}
+	}
+	return sb.String()
 }
 
+var (
+	// MySQL - 8.0+
+	MySQL = &Dialect{Name: "mysql", RowValues: true, ForUpdate: true, ForShare: true, LockInShareMode: true, LockWait: true, DefaultValues: true}
+	// MySQL57 - 5.7, ForShare is `lock in share mode`, NoWait and SkipLocked are rejected
+	MySQL57 = &Dialect{Name: "mysql5.7", RowValues: true, ForUpdate: true, LockInShareMode: true, DefaultValues: true}
+	// SQLite - row values require 3.15+, returning 3.35+, locking clauses are rejected, no `default` in values
+	SQLite = &Dialect{Name: "sqlite", RowValues: true, Returning: true}
+)
+
 // Table .
 func Table(db BormDBIFace, name string) *BormTable {
 	return &BormTable{
@@ -112,18 +168,268 @@ func (t *BormTable) Debug() *BormTable {
 	return t
 }
 
+// Dialect sets the dialect of the database behind the table
+func (t *BormTable) Dialect(d *Dialect) *BormTable {
+	t.Cfg.Dialect = d
+	if d != nil {
+		t.Cfg.keyed, t.Cfg.dialectKey = d, d.key()
+	}
+	return t
+}
+
+var _mysqlKey = MySQL.key()
+
+// dialectKey returns the key of the dialect, worked out once by Dialect
+func (t *BormTable) dialectKey() string {
+	switch t.Cfg.Dialect {
+	case nil:
+		return _mysqlKey
+	case t.Cfg.keyed:
+		return t.Cfg.dialectKey
+	}
+	// set on Cfg directly
+	return t.Cfg.Dialect.key()
+}
+
+func (t *BormTable) dialect() *Dialect {
+	if t.Cfg.Dialect == nil {
+		return MySQL
+	}
+	return t.Cfg.Dialect
+}
+
+// dialectArgs rewrites the conditions the dialect can't express, items are copied not modified
+func (t *BormTable) dialectArgs(args []BormItem) ([]BormItem, error) {
+	d := t.dialect()
+	res := make([]BormItem, len(args))
+	for i, arg := range args {
+		res[i] = arg
+		var err error
+		switch a := arg.(type) {
+		case *whereItem:
+			w := &whereItem{}
+			w.Conds, err = t.resolveConds(a.Conds, d.RowValues)
+			res[i] = w
+		case *havingItem:
+			h := &havingItem{}
+			h.Conds, err = t.resolveConds(a.Conds, d.RowValues)
+			res[i] = h
+		case *joinItem:
+			if a.On != nil {
+				j := *a
+				j.On = &ormCondEx{Ty: _andCondEx}
+				j.On.Conds, err = t.resolveConds(a.On.Conds, d.RowValues)
+				res[i] = &j
+			}
+		case *lockItem:
+			l := *a
+			l.dialect = d
+			if _, err := l.render(); err != nil {
+				return nil, err
+			}
+			res[i] = &l
+		default:
+			err = itemErr(arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// resolveConds resolves InTuple with the columns of the table, as or-ed ands without row values,
+// and returns the error of the first condition that failed to build
+func (t *BormTable) resolveConds(conds []interface{}, rowValues bool) ([]interface{}, error) {
+	res := make([]interface{}, len(conds))
+	for i, c := range conds {
+		res[i] = c
+		switch cond := c.(type) {
+		case *ormCond:
+			if cond.tuple != nil {
+				cond = t.inTuple(cond.tuple)
+			}
+			if cond.err != nil {
+				return nil, cond.err
+			}
+			if cond.orForm != nil && !rowValues {
+				res[i] = cond.orForm
+			} else {
+				res[i] = cond
+			}
+		case *ormCondEx:
+			sub, err := t.resolveConds(cond.Conds, rowValues)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = &ormCondEx{Ty: cond.Ty, Conds: sub}
+		}
+	}
+	return res, nil
+}
+
+// argErr returns the error of a condition or a sub-query of arg that failed to build
+func argErr(arg BormItem) error {
+	switch a := arg.(type) {
+	case *whereItem:
+		return condErr(a.Conds)
+	case *havingItem:
+		return condErr(a.Conds)
+	case *joinItem:
+		if a.On != nil {
+			return condErr(a.On.Conds)
+		}
+		return nil
+	}
+	return itemErr(arg)
+}
+
+func condErr(conds []interface{}) error {
+	for _, c := range conds {
+		switch cond := c.(type) {
+		case *ormCond:
+			if cond.err != nil {
+				return cond.err
+			}
+		case *ormCondEx:
+			if err := condErr(cond.Conds); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// itemErr returns the error of a sub-query of arg that failed to build
+func itemErr(arg interface{}) error {
+	switch a := arg.(type) {
+	case *subQuery:
+		return a.err
+	case *unionItem:
+		for _, sq := range a.Parts {
+			if sq.err != nil {
+				return sq.err
+			}
+		}
+	case *withItem:
+		return itemErr(a.Query)
+	case *fieldsItem:
+		for _, sq := range a.Subs {
+			if sq.err != nil {
+				return sq.err
+			}
+		}
+	}
+	return nil
+}
+
 // UseNameWhenTagEmpty .
 func (t *BormTable) UseNameWhenTagEmpty() *BormTable {
 	t.Cfg.UseNameWhenTagEmpty = true
 	return t
 }
 
+// Naming uses field names without borm tag mapped by naming as columns, like SnakeCase, CamelCase, LowerCase or a custom one
+func (t *BormTable) Naming(naming func(string) string) *BormTable {
+	t.Cfg.UseNameWhenTagEmpty = true
+	t.Cfg.Naming = naming
+	// the cached columns were named by the previous naming
+	fm := t.fieldMaps()
+	fm.Range(func(k, _ interface{}) bool {
+		fm.Delete(k)
+		return true
+	})
+	return t
+}
+
+// columnName returns the column of an untagged field named name
+func (t *BormTable) columnName(name string) string {
+	if t.Cfg.Naming != nil {
+		return t.Cfg.Naming(name)
+	}
+	return name
+}
+
+// SnakeCase maps `UserID` to `user_id`
+func SnakeCase(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if isUpperAt(name, i) {
+			// a new word begins after a lower letter or digit, or at the last upper letter of an acronym
+			if i > 0 && name[i-1] != '_' && (!isUpperAt(name, i-1) || i+1 < len(name) && isLowerAt(name, i+1)) {
+				sb.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// CamelCase maps `UserID` to `userID` and `HTTPServer` to `httpServer`
+func CamelCase(name string) string {
+	n := 0
+	for n < len(name) && isUpperAt(name, n) {
+		n++
+	}
+	if n > 1 && n < len(name) {
+		n-- // the last upper letter begins the next word
+	}
+	return strings.ToLower(name[:n]) + name[n:]
+}
+
+// LowerCase maps `UserID` to `userid`
+func LowerCase(name string) string {
+	return strings.ToLower(name)
+}
+
+func isUpperAt(s string, i int) bool {
+	return 'A' <= s[i] && s[i] <= 'Z'
+}
+
+func isLowerAt(s string, i int) bool {
+	return 'a' <= s[i] && s[i] <= 'z'
+}
+
 // ToTimestamp .
 func (t *BormTable) ToTimestamp() *BormTable {
 	t.Cfg.ToTimestamp = true
 	return t
 }
 
+// AutoQualify selects unprefixed struct columns as `table`.`column`, so that the same struct works with joins
+func (t *BormTable) AutoQualify() *BormTable {
+	t.Cfg.AutoQualify = true
+	return t
+}
+
+// Clock sets the time source of autoCreateTime and autoUpdateTime fields
+func (t *BormTable) Clock(now func() time.Time) *BormTable {
+	t.Cfg.Clock = now
+	return t
+}
+
+// SoftDelete sets the soft-delete column from the field of model tagged `softDelete`, for Delete and Update without a struct
+func (t *BormTable) SoftDelete(model interface{}) *BormTable {
+	t.Cfg.softDelete = t.findSoftDelete(model)
+	return t
+}
+
+// Unscoped neither filters soft-deleted rows out nor soft deletes
+func (t *BormTable) Unscoped() *BormTable {
+	t.Cfg.Unscoped = true
+	return t
+}
+
+// qualifier returns the table name used to qualify columns, empty if disabled
+func (t *BormTable) qualifier() string {
+	if !t.Cfg.AutoQualify || strings.ContainsAny(t.Name, ",( `.") {
+		return ""
+	}
+	return t.Name
+}
+
 // Fields .
 func Fields(fields ...string) *fieldsItem {
 	return &fieldsItem{Fields: fields}
@@ -134,6 +440,32 @@ func Join(stmt string) *joinItem {
 	return &joinItem{Stmt: stmt}
 }
 
+// InnerJoin - on takes the same conditions as Where, e.g. InnerJoin("t_tag", "g", Cond("`g`.`uid`=`t_usr`.`id`"), Eq("g.tag", tag))
+func InnerJoin(table, alias string, on ...interface{}) *joinItem {
+	return newJoin("inner join", table, alias, on)
+}
+
+// LeftJoin .
+func LeftJoin(table, alias string, on ...interface{}) *joinItem {
+	return newJoin("left join", table, alias, on)
+}
+
+// RightJoin .
+func RightJoin(table, alias string, on ...interface{}) *joinItem {
+	return newJoin("right join", table, alias, on)
+}
+
+func newJoin(kind, table, alias string, on []interface{}) *joinItem {
+	j := &joinItem{Kind: kind, Table: table, Alias: alias}
+	if len(on) > 0 {
+		if s, ok := on[0].(string); ok {
+			on = []interface{}{&ormCond{Op: s, Args: on[1:]}}
+		}
+		j.On = &ormCondEx{Ty: _andCondEx, Conds: on}
+	}
+	return j
+}
+
 // Where .
 func Where(conds ...interface{}) *whereItem {
 	if l := len(conds); l > 0 {
@@ -218,10 +550,17 @@ func OnDuplicateKeyUpdate(keyVals V) *onDuplicateKeyUpdateItem {
 		return res
 	}
 
+	keys := make([]string, 0, len(keyVals))
+	for k := range keyVals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	var sb strings.Builder
 	sb.WriteString(" on duplicate key update ")
 	argCnt := 0
-	for k, v := range keyVals {
+	for _, k := range keys {
+		v := keyVals[k]
 		if argCnt > 0 {
 			sb.WriteString(",")
 		}
@@ -239,14 +578,56 @@ func OnDuplicateKeyUpdate(keyVals V) *onDuplicateKeyUpdateItem {
 	return res
 }
 
-// ForceIndex .
-func ForceIndex(idx string) *forceIndexItem {
-	return &forceIndexItem{idx: idx}
+// OnDuplicateKeyUpdateAll - `on duplicate key update a=values(a),...` for the inserted fields of a struct, but `pk`, `auto`, `readonly` and `noupdate` ones
+func OnDuplicateKeyUpdateAll() *onDuplicateKeyUpdateItem {
+	return &onDuplicateKeyUpdateItem{All: true}
+}
+
+// ForUpdate - `for update`, placed after limit
+func ForUpdate() *lockItem {
+	return &lockItem{Mode: _forUpdate}
+}
+
+// ForShare - `for share`, or `lock in share mode` if the dialect has no `for share`
+func ForShare() *lockItem {
+	return &lockItem{Mode: _forShare}
+}
+
+// LockInShareMode - `lock in share mode`, or `for share` if the dialect has no `lock in share mode`
+func LockInShareMode() *lockItem {
+	return &lockItem{Mode: _lockInShareMode}
+}
+
+// ForceIndex - `force index(idx...)` after the table, with ForJoin/ForOrderBy/ForGroupBy to scope it
+func ForceIndex(idx ...string) *indexHintItem {
+	return &indexHintItem{Kind: "force", Indexes: idx}
+}
+
+// UseIndex .
+func UseIndex(idx ...string) *indexHintItem {
+	return &indexHintItem{Kind: "use", Indexes: idx}
+}
+
+// IgnoreIndex .
+func IgnoreIndex(idx ...string) *indexHintItem {
+	return &indexHintItem{Kind: "ignore", Indexes: idx}
+}
+
+// OptimizerHint - `select /*+ hints */`, e.g. OptimizerHint("MAX_EXECUTION_TIME(1000)")
+func OptimizerHint(hints ...string) *optimizerHintItem {
+	return &optimizerHintItem{Hints: hints}
 }
 
 // Select .
 func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 	// Allow Select without any arguments for unconditional queries
+	args, err := t.dialectArgs(args)
+	if err != nil {
+		return 0, err
+	}
+	t, args = t.withCTE(args)
+	t = t.scoped(res)
+	args = t.scopeArgs(args)
 
 	var (
 		rt         = reflect2.TypeOf(res)
@@ -291,11 +672,18 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 
 		var sb strings.Builder
 		sb.WriteString("select ")
+		writeOptimizerHints(&sb, args)
 		fi.BuildSQL(&sb)
 		sb.WriteString(" from ")
-		fieldEscape(&sb, t.Name)
 		var stmtArgs []interface{}
-		for _, arg := range args[1:] {
+		fi.BuildArgs(&stmtArgs)
+		if u := selectUnion(args); u != nil {
+			u.BuildSQL(&sb)
+			u.BuildArgs(&stmtArgs)
+			sb.WriteString(" as ")
+		}
+		fieldEscape(&sb, t.Name)
+		for _, arg := range mergeSelectArgs(args[1:]) {
 			arg.BuildSQL(&sb)
 			arg.BuildArgs(&stmtArgs)
 		}
@@ -376,11 +764,16 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 		}
 	}
 
+	var shapeKey string
 	if t.Cfg.Reuse {
-		callSite := getCallSite()
-		shapeKey := buildShapeKey(callSite.Key, "Select", args)
+		shapeKey = t.reuseKey(getCallSite(), "Select", res, args)
 		if i, ok := _dataBindingCache.Load(shapeKey); ok {
-			item = i.(*DataBindingItem)
+			// scan into this call's res
+			if isArray {
+				item = i.(*DataBindingItem).bind(rtElem.New())
+			} else {
+				item = i.(*DataBindingItem).bind(res)
+			}
 		}
 	}
 
@@ -388,6 +781,7 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 		// struct type
 		if rtElem.Kind() == reflect.Struct {
 			if len(args) > 0 && args[0].Type() == _fields {
+				args[0].BuildArgs(&stmtArgs)
 				args = args[1:]
 			}
 			// map type
@@ -396,36 +790,15 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 			// other types
 		} else {
 			if len(args) > 0 {
+				(&fieldsItem{Fields: args[0].(*fieldsItem).Fields[:1], Subs: args[0].(*fieldsItem).Subs}).BuildArgs(&stmtArgs)
 				args = args[1:]
 			}
 		}
 
-		// Merge multiple Where clauses into one for cached path
-		var mergedWhere *whereItem
-		var mergedArgs []BormItem
-		for _, arg := range args {
-			if arg.Type() == _where {
-				if w, ok := arg.(*whereItem); ok {
-					if mergedWhere == nil {
-						mergedWhere = w
-					} else {
-						// Merge conditions from the new Where into the existing one
-						mergedWhere.Conds = append(mergedWhere.Conds, w.Conds...)
-					}
-				}
-			} else {
-				mergedArgs = append(mergedArgs, arg)
-			}
-		}
-		// Add merged Where clause first if it exists
-		if mergedWhere != nil {
-			mergedArgs = append([]BormItem{mergedWhere}, mergedArgs...)
-		} else {
-			// No Where clause to merge, use original args
-			mergedArgs = args
+		if u := selectUnion(args); u != nil {
+			u.BuildArgs(&stmtArgs)
 		}
-
-		for _, arg := range mergedArgs {
+		for _, arg := range mergeSelectArgs(args) {
 			arg.BuildArgs(&stmtArgs)
 		}
 	} else {
@@ -433,6 +806,7 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 
 		var sb strings.Builder
 		sb.WriteString("select ")
+		writeOptimizerHints(&sb, args)
 
 		if isArray {
 			item.Elem = rtElem.New()
@@ -448,43 +822,36 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 				m := t.getStructFieldMap(s)
 
 				for _, field := range args[0].(*fieldsItem).Fields {
-					f := m[field]
-					item.Cols = append(item.Cols, &scanner{
-						Type: f.Type(),
-						Val:  f.UnsafeGet(reflect2.PtrOf(item.Elem)),
-					})
+					c := m[field]
+					if c == nil {
+						return 0, fmt.Errorf("field %s not found in the struct", field)
+					}
+					item.addCol(c)
 				}
 
-				(args[0]).BuildSQL(&sb)
+				fi := *args[0].(*fieldsItem)
+				fi.Table = t.qualifier()
+				fi.BuildSQL(&sb)
+				fi.BuildArgs(&stmtArgs)
 				args = args[1:]
 
 			} else {
-				for i := 0; i < s.NumField(); i++ {
-					f := s.Field(i)
-					ft := f.Tag().Get("borm")
-
-					if ft == "-" {
-						continue
-					}
-
-					if !t.Cfg.UseNameWhenTagEmpty && ft == "" {
+				cols := t.structColumns(s)
+				for i := range cols {
+					c := &cols[i]
+					if strings.HasSuffix(c.Name, ".*") {
+						if err := t.selectNested(&sb, item, c.Field, c.Name[:len(c.Name)-2]); err != nil {
+							return 0, err
+						}
 						continue
 					}
 
 					if len(item.Cols) > 0 {
 						sb.WriteString(",")
 					}
+					qualifiedEscape(&sb, t.qualifier(), c.Name)
 
-					if ft == "" {
-						fieldEscape(&sb, f.Name())
-					} else {
-						fieldEscape(&sb, ft)
-					}
-
-					item.Cols = append(item.Cols, &scanner{
-						Type: f.Type(),
-						Val:  f.UnsafeGet(reflect2.PtrOf(item.Elem)),
-					})
+					item.addCol(c)
 				}
 			}
 			// map type
@@ -507,40 +874,22 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 				Val:  reflect2.PtrOf(item.Elem),
 			})
 
-			fieldEscape(&sb, fi.Fields[0])
+			first := &fieldsItem{Fields: fi.Fields[:1], Subs: fi.Subs}
+			first.BuildSQL(&sb)
+			first.BuildArgs(&stmtArgs)
 			args = args[1:]
 		}
 
 		sb.WriteString(" from ")
 
-		fieldEscape(&sb, t.Name)
-
-		// Merge multiple Where clauses into one
-		var mergedWhere *whereItem
-		var mergedArgs []BormItem
-		for _, arg := range args {
-			if arg.Type() == _where {
-				if w, ok := arg.(*whereItem); ok {
-					if mergedWhere == nil {
-						mergedWhere = w
-					} else {
-						// Merge conditions from the new Where into the existing one
-						mergedWhere.Conds = append(mergedWhere.Conds, w.Conds...)
-					}
-				}
-			} else {
-				mergedArgs = append(mergedArgs, arg)
-			}
-		}
-		// Add merged Where clause first if it exists
-		if mergedWhere != nil {
-			mergedArgs = append([]BormItem{mergedWhere}, mergedArgs...)
-		} else {
-			// No Where clause to merge, use original args
-			mergedArgs = args
+		if u := selectUnion(args); u != nil {
+			u.BuildSQL(&sb)
+			u.BuildArgs(&stmtArgs)
+			sb.WriteString(" as ")
 		}
+		fieldEscape(&sb, t.Name)
 
-		for _, arg := range mergedArgs {
+		for _, arg := range mergeSelectArgs(args) {
 			arg.BuildSQL(&sb)
 			arg.BuildArgs(&stmtArgs)
 		}
@@ -548,9 +897,7 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 		item.SQL = sb.String()
 
 		if t.Cfg.Reuse {
-			callSite := getCallSite()
-			shapeKey := buildShapeKey(callSite.Key, "Select", args)
-			_dataBindingCache.Store(shapeKey, item)
+			_dataBindingCache.Store(shapeKey, &DataBindingItem{SQL: item.SQL, Type: item.Type, fields: item.fields})
 		}
 	}
 
@@ -567,6 +914,7 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 			}
 			return 0, err
 		}
+		item.fillNested()
 		return 1, err
 	}
 
@@ -582,6 +930,7 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 		if err != nil {
 			break
 		}
+		item.fillNested()
 
 		if isPtrArray {
 			copyElem := rtElem.UnsafeNew()
@@ -596,6 +945,86 @@ func (t *BormTable) Select(res interface{}, args ...BormItem) (int, error) {
 	return count, err
 }
 
+// selectNested selects the columns of a struct or pointer to struct field tagged `alias.*` from alias
+func (t *BormTable) selectNested(sb *strings.Builder, item *DataBindingItem, f reflect2.StructField, alias string) error {
+	ty := f.Type()
+	if ty.Kind() == reflect.Ptr {
+		ty = ty.(reflect2.PtrType).Elem()
+	}
+	st, ok := ty.(reflect2.StructType)
+	if !ok {
+		return fmt.Errorf("field %s tagged %s.* should be a struct or a pointer to struct", f.Name(), alias)
+	}
+
+	cols := t.nestedColumns(st, f)
+	for i := range cols {
+		if len(item.Cols) > 0 {
+			sb.WriteString(",")
+		}
+		qualifiedEscape(sb, alias, cols[i].Name)
+		item.addCol(&cols[i])
+	}
+	return nil
+}
+
+// mergeSelectArgs merges multiple Where clauses into one, puts index hints and joins before it and locks at the end
+func mergeSelectArgs(args []BormItem) []BormItem {
+	var (
+		hints       []BormItem
+		joins       []BormItem
+		mergedWhere *whereItem
+		mergedArgs  []BormItem
+		locks       []BormItem
+	)
+	for _, arg := range args {
+		switch arg.Type() {
+		case _forceIndex:
+			hints = append(hints, arg)
+		case _join:
+			joins = append(joins, arg)
+		case _union, _optimizerHint:
+			// written by Select after `select ` or as the table
+		case _lock:
+			locks = append(locks, arg)
+		case _where:
+			if w, ok := arg.(*whereItem); ok {
+				if mergedWhere == nil {
+					mergedWhere = w
+				} else {
+					// Merge conditions from the new Where into the existing one
+					mergedWhere.Conds = append(mergedWhere.Conds, w.Conds...)
+				}
+			}
+		default:
+			mergedArgs = append(mergedArgs, arg)
+		}
+	}
+	if mergedWhere != nil {
+		mergedArgs = append([]BormItem{mergedWhere}, mergedArgs...)
+	}
+	return append(append(append(hints, joins...), mergedArgs...), locks...)
+}
+
+// checkInsertArgs rejects With, which prefixes a select, update or delete but can't prefix an insert
+func checkInsertArgs(args []BormItem) error {
+	for _, arg := range args {
+		if arg.Type() == _with {
+			return errors.New("With can't be used with Insert, InsertIgnore or ReplaceInto")
+		}
+	}
+	return nil
+}
+
+// checkLockArgs rejects ForUpdate, ForShare and LockInShareMode, which only a Select takes
+func checkLockArgs(args []BormItem, op string) error {
+	for _, arg := range args {
+		if arg.Type() == _lock {
+			return fmt.Errorf("ForUpdate, ForShare and LockInShareMode can't be used with %s", op)
+		}
+	}
+	return nil
+}
+
 // InsertIgnore .
 func (t *BormTable) InsertIgnore(objs interface{}, args ...BormItem) (int, error) {
 	if config.Mock {
@@ -605,6 +1034,10 @@ func (t *BormTable) InsertIgnore(objs interface{}, args ...BormItem) (int, error
 		}
 	}
 
+	if err := checkInsertArgs(args); err != nil {
+		return 0, err
+	}
+
 	// Check if it's V type (map[string]interface{})
 	if m, ok := objs.(V); ok {
 		return t.insertMapWithPrefix("insert ignore into ", m, args...)
@@ -661,6 +1094,10 @@ func (t *BormTable) ReplaceInto(objs interface{}, args ...BormItem) (int, error)
 		}
 	}
 
+	if err := checkInsertArgs(args); err != nil {
+		return 0, err
+	}
+
 	// Check if it's V type (map[string]interface{})
 	if m, ok := objs.(V); ok {
 		return t.insertMapWithPrefix("replace into ", m, args...)
@@ -689,6 +1126,10 @@ func (t *BormTable) Insert(objs interface{}, args ...BormItem) (int, error) {
 		}
 	}
 
+	if err := checkInsertArgs(args); err != nil {
+		return 0, err
+	}
+
 	// Check if it's V type (map[string]interface{})
 	if m, ok := objs.(V); ok {
 		return t.insertMap(m, args...)
@@ -760,6 +1201,7 @@ func (t *BormTable) insertMap(m V, args ...BormItem) (int, error) {
 				fieldsToProcess = append(fieldsToProcess, k)
 			}
 		}
+		sort.Strings(fieldsToProcess)
 		// Check empty map
 		if len(fieldsToProcess) == 0 {
 			return 0, errors.New("empty map: no fields to insert")
@@ -894,230 +1336,52 @@ func (t *BormTable) insertGenericMap(obj interface{}, mapType reflect2.MapType,
 
 // insertStruct handles insertion of struct types
 func (t *BormTable) insertStruct(objs interface{}, args ...BormItem) (int, error) {
-	var (
-		item     *DataBindingItem
-		stmtArgs []interface{}
-	)
+	return t.insertStructWithPrefix("insert into ", objs, args...)
+}
 
-	if t.Cfg.Reuse {
-		callSite := getCallSite()
-		shapeKey := buildShapeKey(callSite.Key, "Insert", args)
-		if i, ok := _dataBindingCache.Load(shapeKey); ok {
-			item = i.(*DataBindingItem)
-		}
-	}
+// insertMapWithPrefix handles insertion of V type (map[string]interface{}), supports prefix
+func (t *BormTable) insertMapWithPrefix(prefix string, m V, args ...BormItem) (int, error) {
+	var sb strings.Builder
+	var stmtArgs []interface{}
 
-	if item != nil {
-		// Use cached SQL, but need to rebuild parameters
-		for _, arg := range args {
-			arg.BuildArgs(&stmtArgs)
-		}
-	} else {
-		// Build new SQL
-		item = &DataBindingItem{}
-		var sb strings.Builder
-		sb.WriteString("insert into ")
-		fieldEscape(&sb, t.Name)
+	sb.WriteString(prefix)
+	fieldEscape(&sb, t.Name)
+	sb.WriteString(" (")
 
-		rt := reflect2.TypeOf(objs)
-		var isArray bool
-		var isPtrArray bool
-		var rtPtr reflect2.Type
-		switch rt.Kind() {
-		case reflect.Ptr:
-			rt = rt.(reflect2.PtrType).Elem()
-			if rt.Kind() == reflect.Slice {
-				isArray = true
-				rtElem := rt.(reflect2.SliceType).Elem()
-				if rtElem.Kind() == reflect.Ptr {
-					rtPtr = rtElem
-					rt = rtElem.(reflect2.PtrType).Elem()
-					isPtrArray = true
-				} else {
-					rt = rtElem
-				}
+	// Check if there are Fields parameters
+	hasFields := len(args) > 0 && args[0].Type() == _fields
+	var fieldsToProcess []string
+
+	if hasFields {
+		fi := args[0].(*fieldsItem)
+		fieldsToProcess = fi.Fields
+		args = args[1:] // Remove Fields parameter
+	} else {
+		// Process all map fields
+		for k, v := range m {
+			if v != nil {
+				fieldsToProcess = append(fieldsToProcess, k)
 			}
-		default:
-			return 0, errors.New("argument 2 should be map or ptr")
 		}
+		sort.Strings(fieldsToProcess)
+		// Check empty map
+		if len(fieldsToProcess) == 0 {
+			return 0, errors.New("empty map: no fields to insert")
+		}
+	}
 
-		var cols []reflect2.StructField
-
-		// Fields or None
-		// struct type
-		if rt.Kind() != reflect.Struct {
-			return 0, errors.New("non-structure type not supported yet")
+	// Build field list
+	for i, field := range fieldsToProcess {
+		v := m[field]
+		if v != nil {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			fieldEscape(&sb, field)
 		}
+	}
 
-		// Fields or KeyVals or None
-		s := rt.(reflect2.StructType)
-		if len(args) > 0 && args[0].Type() == _fields {
-			m := t.getStructFieldMap(s)
-
-			sb.WriteString(" (")
-			for i, field := range args[0].(*fieldsItem).Fields {
-				f := m[field]
-				if f != nil {
-					cols = append(cols, f)
-				}
-
-				if i > 0 {
-					sb.WriteString(",")
-				}
-				fieldEscape(&sb, field)
-			}
-			sb.WriteString(") values (")
-
-			args = args[1:]
-
-		} else {
-			sb.WriteString(" (")
-			for i := 0; i < s.NumField(); i++ {
-				f := s.Field(i)
-				ft := f.Tag().Get("borm")
-
-				if !t.Cfg.UseNameWhenTagEmpty && ft == "" {
-					continue
-				}
-
-				if len(cols) > 0 {
-					sb.WriteString(",")
-				}
-
-				if ft == "" {
-					fieldEscape(&sb, f.Name())
-				} else {
-					fieldEscape(&sb, ft)
-				}
-
-				cols = append(cols, f)
-			}
-			sb.WriteString(") values (")
-		}
-
-		// Check if there are fields to insert
-		if len(cols) == 0 {
-			return 0, errors.New("no fields to insert")
-		}
-
-		// Build placeholder template for VALUES section (without parentheses, as " values (" was already written)
-		valuesTemplate := ""
-		for i := range cols {
-			if i > 0 {
-				valuesTemplate += ","
-			}
-			valuesTemplate += "?"
-		}
-
-		if isArray {
-			// Batch insert: add VALUES for each element
-			sliceType := reflect2.TypeOf(objs).(reflect2.PtrType).Elem().(reflect2.SliceType)
-			length := sliceType.UnsafeLengthOf(reflect2.PtrOf(objs))
-			for i := 0; i < length; i++ {
-				if i > 0 {
-					sb.WriteString(",")
-				}
-				sb.WriteString("(")
-				sb.WriteString(valuesTemplate)
-				sb.WriteString(")")
-				elemPtr := sliceType.UnsafeGetIndex(reflect2.PtrOf(objs), i)
-				t.inputArgs(&stmtArgs, cols, rtPtr, s, isPtrArray, elemPtr)
-			}
-			sb.WriteString(")")
-		} else {
-			// Single insert
-			sb.WriteString(valuesTemplate)
-			t.inputArgs(&stmtArgs, cols, rt, s, false, reflect2.PtrOf(objs))
-			sb.WriteString(")")
-		}
-
-		for _, arg := range args {
-			arg.BuildSQL(&sb)
-			arg.BuildArgs(&stmtArgs)
-		}
-
-		item.SQL = sb.String()
-
-		if t.Cfg.Reuse {
-			callSite := getCallSite()
-			shapeKey := buildShapeKey(callSite.Key, "Insert", args)
-			// Store field columns to avoid second reflection
-			item := &DataBindingItem{Cols: make([]interface{}, len(cols))}
-			for i := range cols {
-				item.Cols[i] = cols[i]
-			}
-			_dataBindingCache.Store(shapeKey, item)
-		}
-	}
-
-	if t.Cfg.Debug {
-		log.Println(item.SQL, stmtArgs)
-	}
-
-	res, err := t.DB.ExecContext(t.ctx, item.SQL, stmtArgs...)
-	if err != nil {
-		return 0, err
-	}
-
-	// Handle BormLastId field
-	rt := reflect2.TypeOf(objs)
-	if rt.Kind() == reflect.Ptr {
-		rt = rt.(reflect2.PtrType).Elem()
-		if rt.Kind() == reflect.Struct {
-			s := rt.(reflect2.StructType)
-			if f := s.FieldByName("BormLastId"); f != nil {
-				id, _ := res.LastInsertId()
-				f.UnsafeSet(reflect2.PtrOf(objs), reflect2.PtrOf(id))
-			}
-		}
-	}
-
-	row, _ := res.RowsAffected()
-	return int(row), nil
-}
-
-// insertMapWithPrefix handles insertion of V type (map[string]interface{}), supports prefix
-func (t *BormTable) insertMapWithPrefix(prefix string, m V, args ...BormItem) (int, error) {
-	var sb strings.Builder
-	var stmtArgs []interface{}
-
-	sb.WriteString(prefix)
-	fieldEscape(&sb, t.Name)
-	sb.WriteString(" (")
-
-	// Check if there are Fields parameters
-	hasFields := len(args) > 0 && args[0].Type() == _fields
-	var fieldsToProcess []string
-
-	if hasFields {
-		fi := args[0].(*fieldsItem)
-		fieldsToProcess = fi.Fields
-		args = args[1:] // Remove Fields parameter
-	} else {
-		// Process all map fields
-		for k, v := range m {
-			if v != nil {
-				fieldsToProcess = append(fieldsToProcess, k)
-			}
-		}
-		// Check empty map
-		if len(fieldsToProcess) == 0 {
-			return 0, errors.New("empty map: no fields to insert")
-		}
-	}
-
-	// Build field list
-	for i, field := range fieldsToProcess {
-		v := m[field]
-		if v != nil {
-			if i > 0 {
-				sb.WriteString(",")
-			}
-			fieldEscape(&sb, field)
-		}
-	}
-
-	sb.WriteString(") values (")
+	sb.WriteString(") values (")
 
 	// Build VALUES section
 	for i, field := range fieldsToProcess {
@@ -1225,6 +1489,7 @@ func (t *BormTable) insertMapSliceWithPrefix(prefix string, objs interface{}, ar
 				fieldsToProcess = append(fieldsToProcess, k)
 			}
 		}
+		sort.Strings(fieldsToProcess)
 		// Check empty map
 		if len(fieldsToProcess) == 0 {
 			return 0, errors.New("empty map: no fields to insert")
@@ -1378,158 +1643,182 @@ func (t *BormTable) insertGenericMapWithPrefix(prefix string, obj interface{}, m
 
 // insertStructWithPrefix handles insertion of struct types, supports prefix
 func (t *BormTable) insertStructWithPrefix(prefix string, objs interface{}, args ...BormItem) (int, error) {
+	rt := reflect2.TypeOf(objs)
+	var isArray bool
+	var isPtrArray bool
+	var rtPtr reflect2.Type
+	switch rt.Kind() {
+	case reflect.Ptr:
+		rt = rt.(reflect2.PtrType).Elem()
+		if rt.Kind() == reflect.Slice {
+			isArray = true
+			rtElem := rt.(reflect2.SliceType).Elem()
+			if rtElem.Kind() == reflect.Ptr {
+				rtPtr = rtElem
+				rt = rtElem.(reflect2.PtrType).Elem()
+				isPtrArray = true
+			} else {
+				rt = rtElem
+			}
+		}
+	default:
+		return 0, errors.New("argument 2 should be map or ptr")
+	}
+
+	// Fields or None
+	// struct type
+	if rt.Kind() != reflect.Struct {
+		return 0, errors.New("non-structure type not supported yet")
+	}
+
+	// Fields or KeyVals or None
+	s := rt.(reflect2.StructType)
+	if err := t.fillAutoTimes(objs, s, true); err != nil {
+		return 0, err
+	}
+
 	var (
 		item     *DataBindingItem
 		stmtArgs []interface{}
+		cols     []*structColumn
+		autoCol  reflect2.StructField // `auto` field omitted from the insert, to be filled back
+		autoName string               // and its column
 	)
 
-	if t.Cfg.Reuse {
-		callSite := getCallSite()
-		shapeKey := buildShapeKey(callSite.Key, "Insert", args)
-		if i, ok := _dataBindingCache.Load(shapeKey); ok {
-			item = i.(*DataBindingItem)
-		}
-	}
-
-	if item != nil {
-		// Use cached SQL, but need to rebuild parameters
-		for _, arg := range args {
-			arg.BuildArgs(&stmtArgs)
-		}
-	} else {
-		// Build new SQL
-		item = &DataBindingItem{}
-		var sb strings.Builder
-		sb.WriteString(prefix)
-		fieldEscape(&sb, t.Name)
+	// The columns depend on the values of the objects, so they are worked out on every call
+	omitEmpty := false
+	if len(args) > 0 && args[0].Type() == _fields {
+		m := t.getStructFieldMap(s)
 
-		rt := reflect2.TypeOf(objs)
-		var isArray bool
-		var isPtrArray bool
-		var rtPtr reflect2.Type
-		switch rt.Kind() {
-		case reflect.Ptr:
-			rt = rt.(reflect2.PtrType).Elem()
-			if rt.Kind() == reflect.Slice {
-				isArray = true
-				rtElem := rt.(reflect2.SliceType).Elem()
-				if rtElem.Kind() == reflect.Ptr {
-					rtPtr = rtElem
-					rt = rtElem.(reflect2.PtrType).Elem()
-					isPtrArray = true
-				} else {
-					rt = rtElem
-				}
+		for _, field := range args[0].(*fieldsItem).Fields {
+			c := m[field]
+			if c == nil {
+				return 0, fmt.Errorf("field %s not found in the struct", field)
 			}
-		default:
-			return 0, errors.New("argument 2 should be map or ptr")
+			cols = append(cols, c)
 		}
 
-		var cols []reflect2.StructField
-
-		// Fields or None
-		// struct type
-		if rt.Kind() != reflect.Struct {
-			return 0, errors.New("non-structure type not supported yet")
-		}
+		args = args[1:]
 
-		// Fields or KeyVals or None
-		s := rt.(reflect2.StructType)
-		if len(args) > 0 && args[0].Type() == _fields {
-			m := t.getStructFieldMap(s)
+	} else {
+		// `default` in the empty rows of `omitempty` columns where the dialect has it, their zero values otherwise
+		omitEmpty = t.dialect().DefaultValues
+		all := t.structColumns(s)
+		for i := range all {
+			c := &all[i]
+			f, opts := c.Field, c.Opts
+
+			// the zero soft-delete value would insert deleted rows, the column default is left to apply
+			if opts.Contains("readonly") || opts.Contains("softDelete") {
+				continue
+			}
 
-			sb.WriteString(" (")
-			for i, field := range args[0].(*fieldsItem).Fields {
-				f := m[field]
-				if f != nil {
-					cols = append(cols, f)
+			if opts.Contains("auto") && autoCol == nil {
+				if isZeroColumn(objs, f) {
+					autoCol, autoName = f, c.Name
+					continue
 				}
-
-				if i > 0 {
-					sb.WriteString(",")
+				// a literal 0 would be inserted and its id not filled back
+				if hasZeroField(objs, f) {
+					return 0, fmt.Errorf("field %s tagged auto is set in some elements only", f.Name())
 				}
-				fieldEscape(&sb, field)
 			}
-			sb.WriteString(") values (")
-
-			args = args[1:]
-
-		} else {
-			sb.WriteString(" (")
-			for i := 0; i < s.NumField(); i++ {
-				f := s.Field(i)
-				ft := f.Tag().Get("borm")
 
-				if !t.Cfg.UseNameWhenTagEmpty && ft == "" {
-					continue
-				}
+			// left out when empty in all rows
+			if opts.Contains("omitempty") && isZeroColumn(objs, f) {
+				continue
+			}
 
-				if len(cols) > 0 {
-					sb.WriteString(",")
-				}
+			cols = append(cols, c)
+		}
+	}
 
-				if ft == "" {
-					fieldEscape(&sb, f.Name())
-				} else {
-					fieldEscape(&sb, ft)
-				}
+	// Check if there are fields to insert
+	if len(cols) == 0 {
+		return 0, errors.New("no fields to insert")
+	}
 
-				cols = append(cols, f)
+	// Placeholders of VALUES section, bound on every call
+	var vb strings.Builder
+	if isArray {
+		// Batch insert: add VALUES for each element
+		sliceType := reflect2.TypeOf(objs).(reflect2.PtrType).Elem().(reflect2.SliceType)
+		length := sliceType.UnsafeLengthOf(reflect2.PtrOf(objs))
+		ptrs := structPtrs(objs)
+		for i := 0; i < length; i++ {
+			if i > 0 {
+				vb.WriteString("),(")
+			}
+			rc := rowCols(&vb, cols, omitEmpty, ptrs[i])
+			elemPtr := sliceType.UnsafeGetIndex(reflect2.PtrOf(objs), i)
+			if err := t.inputArgs(&stmtArgs, rc, rtPtr, s, isPtrArray, elemPtr); err != nil {
+				return 0, err
 			}
-			sb.WriteString(") values (")
 		}
+	} else {
+		// Single insert
+		rc := rowCols(&vb, cols, omitEmpty, reflect2.PtrOf(objs))
+		if err := t.inputArgs(&stmtArgs, rc, rt, s, false, reflect2.PtrOf(objs)); err != nil {
+			return 0, err
+		}
+	}
+	values := vb.String()
 
-		// Check if there are fields to insert
-		if len(cols) == 0 {
-			return 0, errors.New("no fields to insert")
+	for i, arg := range args {
+		if a, ok := arg.(*onDuplicateKeyUpdateItem); ok && a.All {
+			args = append(args[:i:i], args[i:]...) // the caller's args are left as they are
+			args[i] = updateAll(cols)
 		}
+	}
 
-		// Build placeholder template for VALUES section (without parentheses, as " values (" was already written)
-		valuesTemplate := ""
-		for i := range cols {
-			if i > 0 {
-				valuesTemplate += ","
-			}
-			valuesTemplate += "?"
+	var shapeKey string
+	if t.Cfg.Reuse {
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = c.Name
+		}
+		shapeKey = t.reuseKey(getCallSite(), prefix+"("+strings.Join(names, ",")+") values ("+values+")", objs, args)
+		if i, ok := _dataBindingCache.Load(shapeKey); ok {
+			item = i.(*DataBindingItem)
+		}
+	}
+
+	if item != nil {
+		// Use cached SQL, but need to rebuild parameters
+		for _, arg := range args {
+			arg.BuildArgs(&stmtArgs)
 		}
+	} else {
+		// Build new SQL
+		item = &DataBindingItem{}
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		fieldEscape(&sb, t.Name)
 
-		if isArray {
-			// Batch insert: add VALUES for each element
-			sliceType := reflect2.TypeOf(objs).(reflect2.PtrType).Elem().(reflect2.SliceType)
-			length := sliceType.UnsafeLengthOf(reflect2.PtrOf(objs))
-			for i := 0; i < length; i++ {
-				if i > 0 {
-					sb.WriteString(",")
-				}
-				sb.WriteString("(")
-				sb.WriteString(valuesTemplate)
-				sb.WriteString(")")
-				elemPtr := sliceType.UnsafeGetIndex(reflect2.PtrOf(objs), i)
-				t.inputArgs(&stmtArgs, cols, rtPtr, s, isPtrArray, elemPtr)
+		sb.WriteString(" (")
+		for i, c := range cols {
+			if i > 0 {
+				sb.WriteString(",")
 			}
-			sb.WriteString(")")
-		} else {
-			// Single insert
-			sb.WriteString(valuesTemplate)
-			t.inputArgs(&stmtArgs, cols, rt, s, false, reflect2.PtrOf(objs))
-			sb.WriteString(")")
+			fieldEscape(&sb, c.Name)
 		}
+		sb.WriteString(") values (")
+		sb.WriteString(values)
+		sb.WriteString(")")
 
 		for _, arg := range args {
 			arg.BuildSQL(&sb)
 			arg.BuildArgs(&stmtArgs)
 		}
 
+		if autoCol != nil && t.dialect().Returning {
+			sb.WriteString(" returning ")
+			fieldEscape(&sb, autoName)
+		}
+
 		item.SQL = sb.String()
 
 		if t.Cfg.Reuse {
-			callSite := getCallSite()
-			shapeKey := buildShapeKey(callSite.Key, "Insert", args)
-			// Store field columns to avoid second reflection
-			item := &DataBindingItem{Cols: make([]interface{}, len(cols))}
-			for i := range cols {
-				item.Cols[i] = cols[i]
-			}
 			_dataBindingCache.Store(shapeKey, item)
 		}
 	}
@@ -1538,13 +1827,32 @@ func (t *BormTable) insertStructWithPrefix(prefix string, objs interface{}, args
 		log.Println(item.SQL, stmtArgs)
 	}
 
+	if autoCol != nil && t.dialect().Returning {
+		return t.insertReturning(item.SQL, stmtArgs, objs, autoCol)
+	}
+
 	res, err := t.DB.ExecContext(t.ctx, item.SQL, stmtArgs...)
 	if err != nil {
 		return 0, err
 	}
 
+	row, _ := res.RowsAffected()
+
+	// Fill the generated ids back, consecutive from LastInsertId in a batch, which holds with
+	// auto_increment_increment=1 and no skipped rows, so only when all rows were inserted
+	if autoCol != nil {
+		if id, _ := res.LastInsertId(); id > 0 {
+			ptrs := structPtrs(objs)
+			if len(ptrs) == 1 || int(row) == len(ptrs) {
+				for i, p := range ptrs {
+					setAutoID(autoCol, p, id+int64(i))
+				}
+			}
+		}
+	}
+
 	// Handle BormLastId field
-	rt := reflect2.TypeOf(objs)
+	rt = reflect2.TypeOf(objs)
 	if rt.Kind() == reflect.Ptr {
 		rt = rt.(reflect2.PtrType).Elem()
 		if rt.Kind() == reflect.Struct {
@@ -1556,7 +1864,6 @@ func (t *BormTable) insertStructWithPrefix(prefix string, objs interface{}, args
 		}
 	}
 
-	row, _ := res.RowsAffected()
 	return int(row), nil
 }
 
@@ -1572,6 +1879,18 @@ func (t *BormTable) Update(obj interface{}, args ...BormItem) (int, error) {
 	if len(args) <= 0 {
 		return 0, errors.New("argument 2 cannot be omitted")
 	}
+	if err := checkLockArgs(args, "Update"); err != nil {
+		return 0, err
+	}
+	args, err := t.dialectArgs(args)
+	if err != nil {
+		return 0, err
+	}
+	if t, args = t.withCTE(args); len(args) <= 0 {
+		return 0, errors.New("argument 2 cannot be only With")
+	}
+	t = t.scoped(obj)
+	args = t.scopeArgs(args)
 
 	// Check if it's V type (map[string]interface{})
 	if m, ok := obj.(V); ok {
@@ -1597,9 +1916,7 @@ func (t *BormTable) updateMap(m V, args ...BormItem) (int, error) {
 	var sb strings.Builder
 	var stmtArgs []interface{}
 
-	sb.WriteString("update ")
-	fieldEscape(&sb, t.Name)
-	sb.WriteString(" set ")
+	t.writeUpdateTable(&sb, args)
 
 	// Check if there are Fields parameters
 	hasFields := len(args) > 0 && args[0].Type() == _fields
@@ -1616,6 +1933,7 @@ func (t *BormTable) updateMap(m V, args ...BormItem) (int, error) {
 				fieldsToProcess = append(fieldsToProcess, k)
 			}
 		}
+		sort.Strings(fieldsToProcess)
 	}
 
 	// Build SET section
@@ -1638,7 +1956,9 @@ func (t *BormTable) updateMap(m V, args ...BormItem) (int, error) {
 
 	// Build WHERE conditions
 	for _, arg := range args {
-		arg.BuildSQL(&sb)
+		if !isHint(arg) {
+			arg.BuildSQL(&sb)
+		}
 		arg.BuildArgs(&stmtArgs)
 	}
 
@@ -1661,9 +1981,7 @@ func (t *BormTable) updateGenericMap(obj interface{}, mapType reflect2.MapType,
 	var sb strings.Builder
 	var stmtArgs []interface{}
 
-	sb.WriteString("update ")
-	fieldEscape(&sb, t.Name)
-	sb.WriteString(" set ")
+	t.writeUpdateTable(&sb, args)
 
 	// Use reflect package to get map iterator
 	rv := reflect.ValueOf(obj)
@@ -1705,7 +2023,9 @@ func (t *BormTable) updateGenericMap(obj interface{}, mapType reflect2.MapType,
 
 	// Build WHERE conditions
 	for _, arg := range args {
-		arg.BuildSQL(&sb)
+		if !isHint(arg) {
+			arg.BuildSQL(&sb)
+		}
 		arg.BuildArgs(&stmtArgs)
 	}
 
@@ -1725,109 +2045,148 @@ func (t *BormTable) updateGenericMap(obj interface{}, mapType reflect2.MapType,
 
 // updateStruct handles update of struct types
 func (t *BormTable) updateStruct(obj interface{}, args ...BormItem) (int, error) {
-	// For struct types, cache is not used for now
 	rt := reflect2.TypeOf(obj)
-	useCache := t.Cfg.Reuse && rt.Kind() == reflect.Ptr && rt.(reflect2.PtrType).Elem().Kind() == reflect.Struct
+	var rtPtr reflect2.Type
+	switch rt.Kind() {
+	case reflect.Ptr:
+		rtPtr = rt
+		rt = rt.(reflect2.PtrType).Elem()
+	default:
+		return 0, errors.New("argument 2 should be map or ptr")
+	}
 
-	var (
-		item     *DataBindingItem
-		stmtArgs []interface{}
-	)
+	// Fields or None
+	// struct type
+	if rt.Kind() != reflect.Struct {
+		return 0, errors.New("non-structure type not supported yet")
+	}
 
-	if useCache {
-		callSite := getCallSite()
-		shapeKey := buildShapeKey(callSite.Key, "Update", args)
-		if i, ok := _dataBindingCache.Load(shapeKey); ok {
-			item = i.(*DataBindingItem)
+	// Fields or KeyVals or None
+	s := rt.(reflect2.StructType)
+	if err := t.fillAutoTimes(obj, s, false); err != nil {
+		return 0, err
+	}
+
+	// `version=version+1` in SET, `version=?` in WHERE, cached statements included
+	var (
+		verCol reflect2.StructField // `version` field, bumped on success
+		ver    string
+	)
+	for _, c := range t.structColumns(s) {
+		if c.Opts.Contains("version") {
+			verCol, ver = c.Field, c.Name
+			if inf, ok := verCol.(*inlineField); ok && inf.parent(reflect2.PtrOf(obj)) == nil {
+				return 0, fmt.Errorf("field %s tagged version is under a nil pointer", verCol.Name())
+			}
+			v := reflect.NewAt(verCol.Type().Type1(), verCol.UnsafeGet(reflect2.PtrOf(obj))).Elem().Interface()
+			args = mergeWhere(&whereItem{}, append(args, Where(Eq(ver, v))))
+			break
 		}
 	}
 
-	if item != nil {
-		// When using cache path, still need to build parameters by object
-		// SQL reconstruction is omitted here
-	} else {
-		// Build new SQL
-		item = &DataBindingItem{}
-		var sb strings.Builder
-		sb.WriteString("update ")
-		fieldEscape(&sb, t.Name)
-		sb.WriteString(" set ")
+	var (
+		item     *DataBindingItem
+		stmtArgs []interface{}
+		cols     []*structColumn
+		sb       strings.Builder // the SET list, worked out on every call as `omitempty` fields depend on obj
+	)
 
-		rt := reflect2.TypeOf(obj)
-		var rtPtr reflect2.Type
-		switch rt.Kind() {
-		case reflect.Ptr:
-			rtPtr = rt
-			rt = rt.(reflect2.PtrType).Elem()
-		default:
-			return 0, errors.New("argument 2 should be map or ptr")
-		}
+	if len(args) > 0 && args[0].Type() == _fields {
+		m := t.getStructFieldMap(s)
+
+		for _, field := range args[0].(*fieldsItem).Fields {
+			if verCol != nil && field == ver {
+				continue
+			}
+			c := m[field]
+			if c == nil {
+				return 0, fmt.Errorf("field %s not found in the struct", field)
+			}
 
-		var cols []reflect2.StructField
+			if len(cols) > 0 {
+				sb.WriteString(",")
+			}
+			fieldEscape(&sb, field)
+			sb.WriteString("=?")
 
-		// Fields or None
-		// struct type
-		if rt.Kind() != reflect.Struct {
-			return 0, errors.New("non-structure type not supported yet")
+			cols = append(cols, c)
 		}
 
-		// Fields or KeyVals or None
-		s := rt.(reflect2.StructType)
-		if len(args) > 0 && args[0].Type() == _fields {
-			m := t.getStructFieldMap(s)
+		args = args[1:]
 
-			for i, field := range args[0].(*fieldsItem).Fields {
-				f := m[field]
-				if f != nil {
-					cols = append(cols, f)
-				}
+	} else {
+		all := t.structColumns(s)
+		for i := range all {
+			c := &all[i]
+			f, opts := c.Field, c.Opts
 
-				if i > 0 {
-					sb.WriteString(",")
-				}
-				fieldEscape(&sb, field)
-				sb.WriteString("=?")
+			if opts.Contains("pk") || opts.Contains("readonly") || opts.Contains("noupdate") || opts.Contains("version") || opts.Contains("softDelete") {
+				continue
 			}
 
-			args = args[1:]
+			if opts.Contains("omitempty") && isZeroField(f, reflect2.PtrOf(obj)) {
+				continue
+			}
 
-		} else {
-			for i := 0; i < s.NumField(); i++ {
-				f := s.Field(i)
-				ft := f.Tag().Get("borm")
+			if len(cols) > 0 {
+				sb.WriteString(",")
+			}
+			fieldEscape(&sb, c.Name)
+			sb.WriteString("=?")
 
-				if !t.Cfg.UseNameWhenTagEmpty && ft == "" {
-					continue
-				}
+			cols = append(cols, c)
+		}
 
-				if len(cols) > 0 {
-					sb.WriteString(",")
-				}
+		if len(cols) == 0 && verCol == nil {
+			return 0, errors.New("no fields to update")
+		}
+	}
 
-				if ft == "" {
-					fieldEscape(&sb, f.Name())
-					sb.WriteString("=?")
-				} else {
-					fieldEscape(&sb, ft)
-					sb.WriteString("=?")
-				}
+	if verCol != nil {
+		if len(cols) > 0 {
+			sb.WriteString(",")
+		}
+		fieldEscape(&sb, ver)
+		sb.WriteString("=")
+		fieldEscape(&sb, ver)
+		sb.WriteString("+1")
+	}
+	set := sb.String()
 
-				cols = append(cols, f)
-			}
+	if err := t.inputArgs(&stmtArgs, cols, rtPtr, s, false, reflect2.PtrOf(obj)); err != nil {
+		return 0, err
+	}
+
+	var shapeKey string
+	if t.Cfg.Reuse {
+		shapeKey = t.reuseKey(getCallSite(), "Update "+set, obj, args)
+		if i, ok := _dataBindingCache.Load(shapeKey); ok {
+			item = i.(*DataBindingItem)
 		}
+	}
 
-		t.inputArgs(&stmtArgs, cols, rtPtr, s, false, reflect2.PtrOf(obj))
+	if item != nil {
+		// Use cached SQL, but need to rebuild parameters
+		for _, arg := range args {
+			arg.BuildArgs(&stmtArgs)
+		}
+	} else {
+		// Build new SQL
+		item = &DataBindingItem{}
+		var sb strings.Builder
+		t.writeUpdateTable(&sb, args)
+		sb.WriteString(set)
 
 		for _, arg := range args {
-			arg.BuildSQL(&sb)
+			if !isHint(arg) {
+				arg.BuildSQL(&sb)
+			}
 			arg.BuildArgs(&stmtArgs)
 		}
 
 		item.SQL = sb.String()
 
-		if useCache {
-			callSite := getCallSite()
-			shapeKey := buildShapeKey(callSite.Key, "Update", args)
+		if t.Cfg.Reuse {
 			_dataBindingCache.Store(shapeKey, item)
 		}
 	}
@@ -1842,30 +2201,73 @@ func (t *BormTable) updateStruct(obj interface{}, args ...BormItem) (int, error)
 	}
 
 	row, _ := res.RowsAffected()
+	if verCol != nil {
+		if row <= 0 {
+			return 0, ErrStaleObject
+		}
+		v := reflect.NewAt(verCol.Type().Type1(), verCol.UnsafeGet(reflect2.PtrOf(obj))).Elem()
+		if v.CanInt() {
+			v.SetInt(v.Int() + 1)
+		} else {
+			v.SetUint(v.Uint() + 1)
+		}
+	}
 	return int(row), nil
 }
 
-// Delete .
+// Delete . sets the soft-delete column instead, if any
 func (t *BormTable) Delete(args ...BormItem) (int, error) {
+	return t.delete(false, args...)
+}
+
+// HardDelete deletes the rows even if the table has a soft-delete column
+func (t *BormTable) HardDelete(args ...BormItem) (int, error) {
+	return t.delete(true, args...)
+}
+
+func (t *BormTable) delete(hard bool, args ...BormItem) (int, error) {
 	if len(args) <= 0 {
 		return 0, errors.New("argument 1 cannot be omitted")
 	}
+	if err := checkLockArgs(args, "Delete"); err != nil {
+		return 0, err
+	}
+	for _, arg := range args {
+		if arg.Type() == _forceIndex {
+			// MySQL takes them in multi-table deletes only
+			return 0, errors.New("ForceIndex, UseIndex and IgnoreIndex can't be used with Delete")
+		}
+	}
+	args, err := t.dialectArgs(args)
+	if err != nil {
+		return 0, err
+	}
+	if t, args = t.withCTE(args); len(args) <= 0 {
+		return 0, errors.New("argument 1 cannot be only With")
+	}
 
 	if config.Mock {
-		pc, fileName, _, _ := runtime.Caller(1)
+		pc, fileName, _, _ := runtime.Caller(2)
 		if ok, _, n, e := checkMock(t.Name, "Delete", runtime.FuncForPC(pc).Name(), fileName, path.Dir(fileName)); ok {
 			return n, e
 		}
 	}
 
+	if !hard {
+		args = t.scopeArgs(args)
+		if sd := t.Cfg.softDelete; sd != nil && !t.Cfg.Unscoped {
+			return t.updateMap(V{sd.Name: sd.deleted(t)}, args...)
+		}
+	}
+
 	var (
 		item     *DataBindingItem
 		stmtArgs []interface{}
 	)
 
+	var shapeKey string
 	if t.Cfg.Reuse {
-		callSite := getCallSite()
-		shapeKey := buildShapeKey(callSite.Key, "Delete", args)
+		shapeKey = t.reuseKey(getCallSite(), "Delete", nil, args)
 		if i, ok := _dataBindingCache.Load(shapeKey); ok {
 			item = i.(*DataBindingItem)
 		}
@@ -1880,19 +2282,21 @@ func (t *BormTable) Delete(args ...BormItem) (int, error) {
 		// Build new SQL
 		item = &DataBindingItem{}
 		var sb strings.Builder
-		sb.WriteString("delete from ")
+		sb.WriteString("delete ")
+		writeOptimizerHints(&sb, args)
+		sb.WriteString("from ")
 		fieldEscape(&sb, t.Name)
 
 		for _, arg := range args {
-			arg.BuildSQL(&sb)
+			if !isHint(arg) {
+				arg.BuildSQL(&sb)
+			}
 			arg.BuildArgs(&stmtArgs)
 		}
 
 		item.SQL = sb.String()
 
 		if t.Cfg.Reuse {
-			callSite := getCallSite()
-			shapeKey := buildShapeKey(callSite.Key, "Delete", args)
 			_dataBindingCache.Store(shapeKey, item)
 		}
 	}
@@ -1910,8 +2314,369 @@ func (t *BormTable) Delete(args ...BormItem) (int, error) {
 	return int(row), nil
 }
 
-func (t *BormTable) inputArgs(stmtArgs *[]interface{}, cols []reflect2.StructField, rtPtr, s reflect2.Type, ptr bool, x unsafe.Pointer) {
-	for _, col := range cols {
+// GetByPK selects the row whose primary key, the fields tagged `pk`, is that of the struct res points to
+func (t *BormTable) GetByPK(res interface{}, args ...BormItem) (int, error) {
+	w, err := t.pkWhere(res)
+	if err != nil {
+		return 0, err
+	}
+	return t.Select(res, mergeWhere(w, args)...)
+}
+
+// UpdateByPK updates the row by the primary key of obj, the fields tagged `pk` are not set
+func (t *BormTable) UpdateByPK(obj interface{}, args ...BormItem) (int, error) {
+	w, err := t.pkWhere(obj)
+	if err != nil {
+		return 0, err
+	}
+	return t.Update(obj, mergeWhere(w, args)...)
+}
+
+// DeleteByPK deletes the row by the primary key of obj
+func (t *BormTable) DeleteByPK(obj interface{}, args ...BormItem) (int, error) {
+	w, err := t.pkWhere(obj)
+	if err != nil {
+		return 0, err
+	}
+	return t.scoped(obj).Delete(mergeWhere(w, args)...)
+}
+
+// pkWhere builds `pk1=? and pk2=?` from the fields of *struct obj tagged `pk`
+func (t *BormTable) pkWhere(obj interface{}) (*whereItem, error) {
+	rt := reflect2.TypeOf(obj)
+	if rt.Kind() != reflect.Ptr || rt.(reflect2.PtrType).Elem().Kind() != reflect.Struct {
+		return nil, errors.New("argument should be ptr to struct")
+	}
+	s := rt.(reflect2.PtrType).Elem().(reflect2.StructType)
+
+	m := t.getStructFieldMap(s)
+	var names []string
+	for name, c := range m {
+		if c.Opts.Contains("pk") {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= 0 {
+		return nil, fmt.Errorf("no field of %s is tagged pk", s.String())
+	}
+	sort.Strings(names)
+
+	w := &whereItem{}
+	for _, name := range names {
+		f := m[name].Field
+		// a copy, the struct may be scanned into before the args are used
+		v := reflect.NewAt(f.Type().Type1(), f.UnsafeGet(reflect2.PtrOf(obj))).Elem()
+		if v.IsZero() {
+			return nil, fmt.Errorf("primary key %s is zero", name)
+		}
+		w.Conds = append(w.Conds, Eq(name, v.Interface()))
+	}
+	return w, nil
+}
+
+// softDeleteCol is the column of the field tagged `softDelete`
+type softDeleteCol struct {
+	Name  string
+	Null  bool // time fields, null until deleted
+	Flag  bool // 1 once deleted, otherwise the unix timestamp of deletion
+	Milli bool
+}
+
+// findSoftDelete returns the `softDelete` column of the struct obj is or points to, nil if none
+func (t *BormTable) findSoftDelete(obj interface{}) *softDeleteCol {
+	rt := reflect2.TypeOf(obj)
+	for rt != nil && (rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice) {
+		if rt.Kind() == reflect.Ptr {
+			rt = rt.(reflect2.PtrType).Elem()
+		} else {
+			rt = rt.(reflect2.SliceType).Elem()
+		}
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for _, c := range t.structColumns(rt.(reflect2.StructType)) {
+		f, opts := c.Field, c.Opts
+		if !opts.Contains("softDelete") {
+			continue
+		}
+		sd := &softDeleteCol{Name: c.Name, Flag: opts.Contains("flag"), Milli: opts.Contains("milli")}
+		switch ty := f.Type().Type1(); {
+		case ty == reflect.TypeOf(time.Time{}) || ty == reflect.TypeOf(&time.Time{}):
+			sd.Null = true
+		case ty.Kind() == reflect.Bool:
+			sd.Flag = true
+		}
+		return sd
+	}
+	return nil
+}
+
+// deleted is the value the column is set to by a soft delete
+func (sd *softDeleteCol) deleted(t *BormTable) interface{} {
+	if sd.Flag {
+		return 1
+	}
+	now := time.Now()
+	if t.Cfg.Clock != nil {
+		now = t.Cfg.Clock()
+	}
+	switch {
+	case sd.Null && !t.Cfg.ToTimestamp:
+		return now.Format(_timeLayout)
+	case sd.Milli:
+		return now.UnixMilli()
+	}
+	return now.Unix()
+}
+
+// scoped returns a copy of the table with the soft-delete column of obj's struct, or the table itself
+func (t *BormTable) scoped(obj interface{}) *BormTable {
+	sd := t.findSoftDelete(obj)
+	if sd == nil || t.Cfg.Unscoped {
+		return t
+	}
+	nt := t.derive(t.DB)
+	nt.Cfg.softDelete = sd
+	return nt
+}
+
+// scopeArgs filters soft-deleted rows out by adding `deleted_at is null`, or `=0`, to the Where of args
+func (t *BormTable) scopeArgs(args []BormItem) []BormItem {
+	sd := t.Cfg.softDelete
+	if sd == nil || t.Cfg.Unscoped {
+		return args
+	}
+
+	field := sd.Name
+	for _, arg := range args {
+		switch arg.Type() {
+		case _union:
+			return args
+		case _join:
+			field = ""
+		}
+	}
+	if field == "" || t.qualifier() != "" {
+		var sb strings.Builder
+		qualifiedEscape(&sb, t.Name, sd.Name)
+		field = sb.String()
+	}
+
+	if sd.Null {
+		return mergeWhere(Where(IsNull(field)), args)
+	}
+	return mergeWhere(Where(Eq(field, 0)), args)
+}
+
+// mergeWhere puts the conditions of w and the Where of args together, after Fields if any
+func mergeWhere(w *whereItem, args []BormItem) []BormItem {
+	var res []BormItem
+	for _, arg := range args {
+		if aw, ok := arg.(*whereItem); ok {
+			for _, c := range aw.Conds {
+				// raw conditions may contain `or`
+				if cond, ok := c.(*ormCond); ok && cond.Field == "" {
+					c = &ormCond{Op: "(" + cond.Op + ")", Args: cond.Args}
+				}
+				w.Conds = append(w.Conds, c)
+			}
+		} else {
+			res = append(res, arg)
+		}
+	}
+	if len(res) > 0 && res[0].Type() == _fields {
+		return append([]BormItem{res[0], w}, res[1:]...)
+	}
+	return append([]BormItem{w}, res...)
+}
+
+// insertReturning executes the insert with `returning` and fills the ids back in order
+func (t *BormTable) insertReturning(sql string, stmtArgs []interface{}, objs interface{}, autoCol reflect2.StructField) (int, error) {
+	if t.Cfg.Debug {
+		log.Println(sql, stmtArgs)
+	}
+
+	rows, err := t.DB.QueryContext(t.ctx, sql, stmtArgs...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if ptrs := structPtrs(objs); len(ids) == len(ptrs) {
+		for i, p := range ptrs {
+			setAutoID(autoCol, p, ids[i])
+		}
+	}
+	return len(ids), nil
+}
+
+// structPtrs returns pointers to the structs of *struct, *[]struct or *[]*struct objs
+func structPtrs(objs interface{}) []unsafe.Pointer {
+	rt := reflect2.TypeOf(objs).(reflect2.PtrType).Elem()
+	if rt.Kind() != reflect.Slice {
+		return []unsafe.Pointer{reflect2.PtrOf(objs)}
+	}
+	st := rt.(reflect2.SliceType)
+	n := st.UnsafeLengthOf(reflect2.PtrOf(objs))
+	ptrs := make([]unsafe.Pointer, n)
+	for i := range ptrs {
+		ptrs[i] = st.UnsafeGetIndex(reflect2.PtrOf(objs), i)
+		if st.Elem().Kind() == reflect.Ptr {
+			ptrs[i] = *(*unsafe.Pointer)(ptrs[i])
+		}
+	}
+	return ptrs
+}
+
+// isZeroField reports whether the field f of the struct at p is zero
+func isZeroField(f reflect2.StructField, p unsafe.Pointer) bool {
+	return reflect.NewAt(f.Type().Type1(), f.UnsafeGet(p)).Elem().IsZero()
+}
+
+// isZeroColumn reports whether the field f is zero in all structs of objs
+func isZeroColumn(objs interface{}, f reflect2.StructField) bool {
+	for _, p := range structPtrs(objs) {
+		if !isZeroField(f, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasZeroField reports whether the field f is zero in some struct of objs
+func hasZeroField(objs interface{}, f reflect2.StructField) bool {
+	for _, p := range structPtrs(objs) {
+		if isZeroField(f, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// fillAutoTimes sets the autoUpdateTime fields of the structs of objs to now, and on insert the zero autoCreateTime ones
+func (t *BormTable) fillAutoTimes(objs interface{}, s reflect2.StructType, insert bool) error {
+	var cs []structColumn
+	for _, c := range t.structColumns(s) {
+		if c.Opts.Contains("autoUpdateTime") || insert && c.Opts.Contains("autoCreateTime") {
+			cs = append(cs, c)
+		}
+	}
+	if len(cs) <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if t.Cfg.Clock != nil {
+		now = t.Cfg.Clock()
+	}
+	for _, p := range structPtrs(objs) {
+		for _, c := range cs {
+			f, opts := c.Field, c.Opts
+			if !opts.Contains("autoUpdateTime") && !isZeroField(f, p) {
+				continue
+			}
+			if inf, ok := f.(*inlineField); ok && inf.parent(p) == nil {
+				return fmt.Errorf("field %s tagged autoUpdateTime or autoCreateTime is under a nil pointer", f.Name())
+			}
+			if err := setAutoTime(reflect.NewAt(f.Type().Type1(), f.UnsafeGet(p)).Elem(), now, opts.Contains("milli")); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// setAutoTime sets v, a time.Time or an integer of at least 32 bits or a pointer to one, to now, in unix seconds or milliseconds for integers
+func setAutoTime(v reflect.Value, now time.Time, milli bool) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	ts := now.Unix()
+	if milli {
+		ts = now.UnixMilli()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() != reflect.TypeOf(now) {
+			break
+		}
+		v.Set(reflect.ValueOf(now))
+		return nil
+	case reflect.Int32, reflect.Uint32:
+		if milli {
+			return errors.New("milliseconds overflow 32-bit integers")
+		}
+		fallthrough
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		if v.CanInt() {
+			v.SetInt(ts)
+		} else {
+			v.SetUint(uint64(ts))
+		}
+		return nil
+	}
+	return fmt.Errorf("type %s not supported for auto time", v.Type())
+}
+
+// rowCols writes the placeholders of a row, `default` for zero `omitempty` fields, and returns the fields to bind
+func rowCols(sb *strings.Builder, cols []*structColumn, omitEmpty bool, p unsafe.Pointer) []*structColumn {
+	res := cols[:0:0]
+	for i, c := range cols {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		if omitEmpty && c.Opts.Contains("omitempty") && isZeroField(c.Field, p) {
+			sb.WriteString("default")
+			continue
+		}
+		sb.WriteString("?")
+		res = append(res, c)
+	}
+	return res
+}
+
+// setAutoID sets the integer `auto` field f of the struct at p
+func setAutoID(f reflect2.StructField, p unsafe.Pointer, id int64) {
+	v := reflect.NewAt(f.Type().Type1(), f.UnsafeGet(p)).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(id))
+	}
+}
+
+func (t *BormTable) inputArgs(stmtArgs *[]interface{}, cols []*structColumn, rtPtr, s reflect2.Type, ptr bool, x unsafe.Pointer) error {
+	p := x
+	if ptr {
+		p = *(*unsafe.Pointer)(x)
+	}
+	for _, c := range cols {
+		col := c.Field
+		// fields of a nil pointer tagged `inline`
+		if f, ok := col.(*inlineField); ok && f.parent(p) == nil {
+			*stmtArgs = append(*stmtArgs, nil)
+			continue
+		}
+
 		var v interface{}
 		if ptr {
 			v = col.Get(rtPtr.UnsafeIndirect(x))
@@ -1919,6 +2684,32 @@ func (t *BormTable) inputArgs(stmtArgs *[]interface{}, cols []reflect2.StructFie
 			v = col.Get(s.PackEFace(x))
 		}
 
+		if c.Opts.Contains("json") {
+			dv, err := JSON(col.Type().Indirect(v)).Value()
+			if err != nil {
+				return err
+			}
+			*stmtArgs = append(*stmtArgs, dv)
+			continue
+		}
+
+		// driver.Valuer, either on the field or on what a pointer field points to
+		if col.Type().Kind() == reflect.Ptr {
+			if p := *(*unsafe.Pointer)(reflect2.PtrOf(v)); p == nil {
+				v = nil
+			} else if vr, ok := col.Type().(reflect2.PtrType).Elem().PackEFace(p).(driver.Valuer); ok {
+				v = vr
+			}
+		}
+		if vr, ok := v.(driver.Valuer); ok {
+			dv, err := vr.Value()
+			if err != nil {
+				return err
+			}
+			*stmtArgs = append(*stmtArgs, dv)
+			continue
+		}
+
 		// Special handling for time type
 		if col.Type().String() == "time.Time" {
 			if t.Cfg.ToTimestamp {
@@ -1930,6 +2721,7 @@ func (t *BormTable) inputArgs(stmtArgs *[]interface{}, cols []reflect2.StructFie
 
 		*stmtArgs = append(*stmtArgs, v)
 	}
+	return nil
 }
 
 // BormDBIFace .
@@ -1945,7 +2737,25 @@ type BormTable struct {
 	Name          string
 	Cfg           Config
 	ctx           context.Context
-	fieldMapCache sync.Map // Field mapping cache
+	fieldMapCache sync.Map   // Field mapping cache
+	base          *BormTable // the table it is derived from, whose field mapping cache it uses
+}
+
+// derive returns a copy of t on db, sharing the field mapping cache of t
+func (t *BormTable) derive(db BormDBIFace) *BormTable {
+	nt := &BormTable{DB: db, Name: t.Name, Cfg: t.Cfg, ctx: t.ctx, base: t}
+	if t.base != nil {
+		nt.base = t.base
+	}
+	return nt
+}
+
+// fieldMaps returns the field mapping cache of t, the one of its base if derived
+func (t *BormTable) fieldMaps() *sync.Map {
+	if t.base != nil {
+		return &t.base.fieldMapCache
+	}
+	return &t.fieldMapCache
 }
 
 func fieldEscape(sb *strings.Builder, field string) {
@@ -1960,55 +2770,199 @@ func fieldEscape(sb *strings.Builder, field string) {
 	}
 }
 
-func (t *BormTable) getStructFieldMap(s reflect2.StructType) map[string]reflect2.StructField {
+// qualifiedEscape writes `table`.`field` for plain column names, and others as fieldEscape
+func qualifiedEscape(sb *strings.Builder, table, field string) {
+	if table != "" && field != "" && !strings.ContainsAny(field, ",( `.") {
+		fieldEscape(sb, table)
+		sb.WriteString(".")
+	}
+	fieldEscape(sb, field)
+}
+
+// tagOptions is the string following a comma in a borm struct field's tag
+type tagOptions string
+
+// parseTag splits a borm struct field's tag into its name and comma-separated options
+func parseTag(tag string) (string, tagOptions) {
+	if idx := strings.IndexByte(tag, ','); idx >= 0 {
+		return tag[:idx], tagOptions(tag[idx+1:])
+	}
+	return tag, ""
+}
+
+// Contains reports whether a comma-separated list of options contains a particular option
+func (o tagOptions) Contains(option string) bool {
+	s := string(o)
+	for s != "" {
+		var name string
+		if idx := strings.IndexByte(s, ','); idx >= 0 {
+			name, s = s[:idx], s[idx+1:]
+		} else {
+			name, s = s, ""
+		}
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldMapKey is the key of fieldMapCache, the columns of a struct depend on UseNameWhenTagEmpty,
+// and on Naming, which resets the cache
+type fieldMapKey struct {
+	Type    reflect2.StructType
+	UseName bool
+}
+
+// structFields are the columns of a struct for the table config
+type structFields struct {
+	Columns []structColumn
+	Fields  map[string]*structColumn // Columns by name
+	Key     string                   // the sorted column names, part of the reuse key
+}
+
+func (t *BormTable) getStructFieldMap(s reflect2.StructType) map[string]*structColumn {
+	return t.structFields(s).Fields
+}
+
+// structFields returns the columns of s, cached per table
+func (t *BormTable) structFields(s reflect2.StructType) *structFields {
+	key := fieldMapKey{Type: s, UseName: t.Cfg.UseNameWhenTagEmpty}
+
 	// Check cache
-	if cached, ok := t.fieldMapCache.Load(s); ok {
-		return cached.(map[string]reflect2.StructField)
+	if cached, ok := t.fieldMaps().Load(key); ok {
+		return cached.(*structFields)
 	}
 
 	// Collect fields
-	m := t.collectStructFields(s, "")
+	sf := &structFields{Columns: t.nestedColumns(s, nil)}
+	sf.Fields = make(map[string]*structColumn, len(sf.Columns))
+	names := make([]string, len(sf.Columns))
+	for i := range sf.Columns {
+		sf.Fields[sf.Columns[i].Name] = &sf.Columns[i]
+		names[i] = sf.Columns[i].Name
+	}
+	sort.Strings(names)
+	sf.Key = strings.Join(names, ",")
 
 	// Cache result
-	t.fieldMapCache.Store(s, m)
-	return m
+	t.fieldMaps().Store(key, sf)
+	return sf
+}
+
+// structColumn is a column of a struct, with the fields of embedded structs and nested structs tagged `inline` flattened
+type structColumn struct {
+	Name  string
+	Field reflect2.StructField
+	Opts  tagOptions // of the borm tag, parsed once
+	depth int
+}
+
+// structColumns returns the columns of s, but fields tagged `-` and untagged ones unless UseNameWhenTagEmpty
+func (t *BormTable) structColumns(s reflect2.StructType) []structColumn {
+	return t.structFields(s).Columns
 }
 
-// collectStructFields recursively collects struct fields, supports embedded struct and field ignoring
-func (t *BormTable) collectStructFields(s reflect2.StructType, prefix string) map[string]reflect2.StructField {
-	m := make(map[string]reflect2.StructField)
+// nestedColumns returns the columns of the struct s in the field parent, if any. Like encoding/json,
+// a column declared at several depths is the shallowest one, and left out if that's ambiguous
+func (t *BormTable) nestedColumns(s reflect2.StructType, parent reflect2.StructField) []structColumn {
+	var cols []structColumn
+	path := []reflect.Type{s.Type1()}
 	for i := 0; i < s.NumField(); i++ {
 		f := s.Field(i)
-		ft := f.Tag().Get("borm")
+		if parent != nil {
+			f = &inlineField{StructField: f, Parent: parent}
+		}
+		cols = t.appendColumns(cols, f, "", 0, path)
+	}
 
-		// Check if field should be ignored
-		if ft == "-" {
-			continue
+	depth := make(map[string]int, len(cols))
+	count := make(map[string]int, len(cols))
+	for _, c := range cols {
+		if d, ok := depth[c.Name]; !ok || c.depth < d {
+			depth[c.Name], count[c.Name] = c.depth, 1
+		} else if c.depth == d {
+			count[c.Name]++
 		}
+	}
+	res := cols[:0]
+	for _, c := range cols {
+		if c.depth == depth[c.Name] && count[c.Name] == 1 {
+			res = append(res, c)
+		}
+	}
+	return res
+}
 
-		// Handle embedded struct
-		if f.Anonymous() {
-			embeddedType := f.Type()
-			if embeddedType.Kind() == reflect.Struct {
-				if embeddedStructType, ok := embeddedType.(reflect2.StructType); ok {
-					// Recursively collect fields from embedded struct
-					embeddedFields := t.collectStructFields(embeddedStructType, prefix)
-					for k, v := range embeddedFields {
-						m[k] = v
-					}
+// appendColumns appends the column of f, or the columns of the struct in f if embedded or tagged `prefix,inline`.
+// path holds the struct types entered so far, like encoding/json, a struct isn't entered again in itself
+func (t *BormTable) appendColumns(cols []structColumn, f reflect2.StructField, prefix string, depth int, path []reflect.Type) []structColumn {
+	ft, opts := parseTag(f.Tag().Get("borm"))
+	if ft == "-" {
+		return cols
+	}
+	if (f.Anonymous() && ft == "") || opts.Contains("inline") {
+		ty := f.Type()
+		if ty.Kind() == reflect.Ptr {
+			ty = ty.(reflect2.PtrType).Elem()
+		}
+		if st, ok := ty.(reflect2.StructType); ok {
+			for _, p := range path {
+				if p == st.Type1() {
+					return cols
 				}
 			}
-			continue
+			path = append(path, st.Type1())
+			for i := 0; i < st.NumField(); i++ {
+				cols = t.appendColumns(cols, &inlineField{StructField: st.Field(i), Parent: f}, prefix+ft, depth+1, path)
+			}
+			return cols
+		}
+	}
+	if ft == "" {
+		if !t.Cfg.UseNameWhenTagEmpty {
+			return cols
 		}
+		ft = t.columnName(f.Name())
+	}
+	return append(cols, structColumn{Name: prefix + ft, Field: f, Opts: opts, depth: depth})
+}
 
-		// Handle normal fields
-		if ft != "" {
-			m[ft] = f
-		} else if t.Cfg.UseNameWhenTagEmpty {
-			m[f.Name()] = f
+// inlineField is a field of the struct in Parent, with offsets from the struct holding Parent
+type inlineField struct {
+	reflect2.StructField
+	Parent reflect2.StructField
+}
+
+// parent returns the struct in Parent, nil if Parent, or any pointer it is under, is nil
+func (f *inlineField) parent(p unsafe.Pointer) unsafe.Pointer {
+	pp := p
+	if pf, ok := f.Parent.(*inlineField); ok {
+		if pp = pf.parent(p); pp == nil {
+			return nil
 		}
+		pp = pf.StructField.UnsafeGet(pp)
+	} else {
+		pp = f.Parent.UnsafeGet(p)
+	}
+	if f.Parent.Type().Kind() == reflect.Ptr {
+		pp = *(*unsafe.Pointer)(pp)
+	}
+	return pp
+}
+
+// UnsafeGet returns a pointer to the field, or to a zero value if Parent is a nil pointer
+func (f *inlineField) UnsafeGet(p unsafe.Pointer) unsafe.Pointer {
+	pp := f.parent(p)
+	if pp == nil {
+		return f.Type().UnsafeNew()
 	}
-	return m
+	return f.StructField.UnsafeGet(pp)
+}
+
+// Get returns a pointer to the field of the struct obj is or points to
+func (f *inlineField) Get(obj interface{}) interface{} {
+	return reflect.NewAt(f.Type().Type1(), f.UnsafeGet(reflect2.PtrOf(obj))).Interface()
 }
 
 // FieldInfo generic field information interface
@@ -2081,7 +3035,7 @@ func (t *BormTable) collectStructFieldsGeneric(objs interface{}, structType refl
 
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
-		ft := field.Tag().Get("borm")
+		ft, _ := parseTag(field.Tag().Get("borm"))
 
 		// Check if field should be ignored
 		if ft == "-" {
@@ -2112,7 +3066,7 @@ func (t *BormTable) collectStructFieldsGeneric(objs interface{}, structType refl
 		if ft != "" {
 			fieldName = ft
 		} else if t.Cfg.UseNameWhenTagEmpty {
-			fieldName = field.Name()
+			fieldName = t.columnName(field.Name())
 		} else {
 			continue
 		}
@@ -2180,27 +3134,75 @@ func (t *BormTable) collectMapFieldsGeneric(objs interface{}, mapType reflect2.M
 
 type fieldsItem struct {
 	Fields []string
+	Subs   map[string]*subQuery // scalar sub-queries by alias
+	Table  string               // qualifies plain column names if set
 }
 
 func (w *fieldsItem) Type() int {
 	return _fields
 }
 
+// Scalar adds the sub-query as a column named alias, e.g. Fields("id").Scalar("cnt", SubQuery(...))
+func (w *fieldsItem) Scalar(alias string, sq *subQuery) *fieldsItem {
+	if w.Subs == nil {
+		w.Subs = make(map[string]*subQuery)
+	}
+	w.Fields = append(w.Fields, alias)
+	w.Subs[alias] = sq
+	return w
+}
+
 func (w *fieldsItem) BuildSQL(sb *strings.Builder) {
 	for i, field := range w.Fields {
 		if i > 0 {
 			sb.WriteString(",")
 		}
+		if sq, ok := w.Subs[field]; ok {
+			sq.BuildSQL(sb)
+			sb.WriteString(" as ")
+		} else if w.Table != "" {
+			qualifiedEscape(sb, w.Table, field)
+			continue
+		}
 		fieldEscape(sb, field)
 	}
 }
 
 func (w *fieldsItem) BuildArgs(stmtArgs *[]interface{}) {
+	for _, field := range w.Fields {
+		if sq, ok := w.Subs[field]; ok {
+			sq.BuildArgs(stmtArgs)
+		}
+	}
 }
 
 type onDuplicateKeyUpdateItem struct {
 	Conds string
 	Vals  []interface{}
+	All   bool // generated from the inserted fields
+}
+
+// updateAll generates the item of OnDuplicateKeyUpdateAll from the inserted fields
+func updateAll(cols []*structColumn) *onDuplicateKeyUpdateItem {
+	var sb strings.Builder
+	for _, c := range cols {
+		ft := c.Name
+		// keys, columns the database maintains, and those borm sets on purpose: creation time, version, deletion
+		if opts := c.Opts; opts.Contains("pk") || opts.Contains("auto") || opts.Contains("readonly") || opts.Contains("noupdate") ||
+			opts.Contains("autoCreateTime") || opts.Contains("version") || opts.Contains("softDelete") {
+			continue
+		}
+		if sb.Len() <= 0 {
+			sb.WriteString(" on duplicate key update ")
+		} else {
+			sb.WriteString(",")
+		}
+		fieldEscape(&sb, ft)
+		sb.WriteString("=values(")
+		fieldEscape(&sb, ft)
+		sb.WriteString(")")
+	}
+	return &onDuplicateKeyUpdateItem{Conds: sb.String()}
 }
 
 func (w *onDuplicateKeyUpdateItem) Type() int {
@@ -2216,7 +3218,18 @@ func (w *onDuplicateKeyUpdateItem) BuildArgs(stmtArgs *[]interface{}) {
 }
 
 type joinItem struct {
-	Stmt string
+	Stmt  string // raw statement of Join
+	Kind  string
+	Table string
+	Alias string
+	Hints []*indexHintItem
+	On    *ormCondEx
+}
+
+// IndexHint adds index hints for the joined table, e.g. InnerJoin(...).IndexHint(UseIndex("idx_uid"))
+func (w *joinItem) IndexHint(hints ...*indexHintItem) *joinItem {
+	w.Hints = append(w.Hints, hints...)
+	return w
 }
 
 func (w *joinItem) Type() int {
@@ -2225,25 +3238,183 @@ func (w *joinItem) Type() int {
 
 func (w *joinItem) BuildSQL(sb *strings.Builder) {
 	sb.WriteString(" ")
-	sb.WriteString(w.Stmt)
+	if w.Kind == "" {
+		sb.WriteString(w.Stmt)
+		return
+	}
+	sb.WriteString(w.Kind)
+	sb.WriteString(" ")
+	fieldEscape(sb, w.Table)
+	if w.Alias != "" {
+		sb.WriteString(" as ")
+		fieldEscape(sb, w.Alias)
+	}
+	for _, h := range w.Hints {
+		h.BuildSQL(sb)
+	}
+	if w.On != nil {
+		sb.WriteString(" on ")
+		w.On.BuildSQL(sb)
+	}
 }
 
 func (w *joinItem) BuildArgs(stmtArgs *[]interface{}) {
+	if w.On != nil {
+		w.On.BuildArgs(stmtArgs)
+	}
+}
+
+const (
+	_forUpdate = iota
+	_forShare
+	_lockInShareMode
+)
+
+type lockItem struct {
+	Mode    int
+	Wait    string // "nowait" or "skip locked"
+	dialect *Dialect
+}
+
+// NoWait fails at once instead of waiting for locked rows
+func (l *lockItem) NoWait() *lockItem {
+	l.Wait = "nowait"
+	return l
 }
 
-type forceIndexItem struct {
-	idx string
+// SkipLocked skips locked rows instead of waiting for them
+func (l *lockItem) SkipLocked() *lockItem {
+	l.Wait = "skip locked"
+	return l
 }
 
-func (w *forceIndexItem) Type() int {
+func (l *lockItem) Type() int {
+	return _lock
+}
+
+// render writes the clause for the dialect, MySQL if not set
+func (l *lockItem) render() (string, error) {
+	d := l.dialect
+	if d == nil {
+		d = MySQL
+	}
+	var sql string
+	switch {
+	case l.Mode == _forUpdate && d.ForUpdate:
+		sql = " for update"
+	case l.Mode == _lockInShareMode && d.LockInShareMode && l.Wait == "":
+		sql = " lock in share mode"
+	case l.Mode != _forUpdate && d.ForShare:
+		sql = " for share"
+	case l.Mode == _forShare && d.LockInShareMode && l.Wait == "":
+		sql = " lock in share mode"
+	default:
+		return "", fmt.Errorf("locking clause is not supported by dialect %s", d.Name)
+	}
+	if l.Wait != "" {
+		if !d.LockWait {
+			return "", fmt.Errorf("%s is not supported by dialect %s", l.Wait, d.Name)
+		}
+		sql += " " + l.Wait
+	}
+	return sql, nil
+}
+
+func (l *lockItem) BuildSQL(sb *strings.Builder) {
+	sql, _ := l.render()
+	sb.WriteString(sql)
+}
+
+func (l *lockItem) BuildArgs(stmtArgs *[]interface{}) {
+}
+
+type indexHintItem struct {
+	Kind    string // force, use or ignore
+	For     string // join, order by or group by
+	Indexes []string
+}
+
+// ForJoin .
+func (w *indexHintItem) ForJoin() *indexHintItem {
+	w.For = "join"
+	return w
+}
+
+// ForOrderBy .
+func (w *indexHintItem) ForOrderBy() *indexHintItem {
+	w.For = "order by"
+	return w
+}
+
+// ForGroupBy .
+func (w *indexHintItem) ForGroupBy() *indexHintItem {
+	w.For = "group by"
+	return w
+}
+
+func (w *indexHintItem) Type() int {
 	return _forceIndex
 }
 
-func (w *forceIndexItem) BuildSQL(sb *strings.Builder) {
-	sb.WriteString(" force index(" + w.idx + ")")
+func (w *indexHintItem) BuildSQL(sb *strings.Builder) {
+	sb.WriteString(" ")
+	sb.WriteString(w.Kind)
+	sb.WriteString(" index")
+	if w.For != "" {
+		sb.WriteString(" for ")
+		sb.WriteString(w.For)
+		sb.WriteString(" ")
+	}
+	sb.WriteString("(")
+	sb.WriteString(strings.Join(w.Indexes, ","))
+	sb.WriteString(")")
+}
+
+func (w *indexHintItem) BuildArgs(stmtArgs *[]interface{}) {
+}
+
+type optimizerHintItem struct {
+	Hints []string
+}
+
+func (w *optimizerHintItem) Type() int {
+	return _optimizerHint
+}
+
+func (w *optimizerHintItem) BuildSQL(sb *strings.Builder) {
+	sb.WriteString("/*+ ")
+	sb.WriteString(strings.Join(w.Hints, " "))
+	sb.WriteString(" */ ")
+}
+
+func (w *optimizerHintItem) BuildArgs(stmtArgs *[]interface{}) {
+}
+
+// writeUpdateTable writes `update /*+ hints */ `table` index hints set `, the hints of an Update in their places
+func (t *BormTable) writeUpdateTable(sb *strings.Builder, args []BormItem) {
+	sb.WriteString("update ")
+	writeOptimizerHints(sb, args)
+	fieldEscape(sb, t.Name)
+	for _, arg := range args {
+		if arg.Type() == _forceIndex {
+			arg.BuildSQL(sb)
+		}
+	}
+	sb.WriteString(" set ")
+}
+
+// isHint reports whether arg is an index or optimizer hint, which Update and Delete write ahead of the other items
+func isHint(arg BormItem) bool {
+	return arg.Type() == _forceIndex || arg.Type() == _optimizerHint
 }
 
-func (w *forceIndexItem) BuildArgs(stmtArgs *[]interface{}) {
+// writeOptimizerHints writes the OptimizerHint items of a Select, Update or Delete after the keyword
+func writeOptimizerHints(sb *strings.Builder, args []BormItem) {
+	for _, arg := range args {
+		if arg.Type() == _optimizerHint {
+			arg.BuildSQL(sb)
+		}
+	}
 }
 
 type whereItem struct {
@@ -2412,9 +3583,210 @@ func strconvErr(err error) error {
 	return err
 }
 
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// setInt stores i64 into a number of kind dk, failing instead of wrapping around
+func setInt(dk reflect.Kind, ptrVal unsafe.Pointer, i64 int64) error {
+	switch dk {
+	case reflect.Int:
+		if int64(int(i64)) != i64 {
+			return strconv.ErrRange
+		}
+		*(*int)(ptrVal) = int(i64)
+	case reflect.Int8:
+		if i64 < math.MinInt8 || i64 > math.MaxInt8 {
+			return strconv.ErrRange
+		}
+		*(*int8)(ptrVal) = int8(i64)
+	case reflect.Int16:
+		if i64 < math.MinInt16 || i64 > math.MaxInt16 {
+			return strconv.ErrRange
+		}
+		*(*int16)(ptrVal) = int16(i64)
+	case reflect.Int32:
+		if i64 < math.MinInt32 || i64 > math.MaxInt32 {
+			return strconv.ErrRange
+		}
+		*(*int32)(ptrVal) = int32(i64)
+	case reflect.Int64:
+		*(*int64)(ptrVal) = i64
+	case reflect.Float32:
+		*(*float32)(ptrVal) = float32(i64)
+	case reflect.Float64:
+		*(*float64)(ptrVal) = float64(i64)
+	default:
+		if i64 < 0 {
+			return strconv.ErrRange
+		}
+		return setUint(dk, ptrVal, uint64(i64))
+	}
+	return nil
+}
+
+// setUint stores u64 into a number of kind dk, failing instead of wrapping around
+func setUint(dk reflect.Kind, ptrVal unsafe.Pointer, u64 uint64) error {
+	switch dk {
+	case reflect.Uint:
+		if uint64(uint(u64)) != u64 {
+			return strconv.ErrRange
+		}
+		*(*uint)(ptrVal) = uint(u64)
+	case reflect.Uint8:
+		if u64 > math.MaxUint8 {
+			return strconv.ErrRange
+		}
+		*(*uint8)(ptrVal) = uint8(u64)
+	case reflect.Uint16:
+		if u64 > math.MaxUint16 {
+			return strconv.ErrRange
+		}
+		*(*uint16)(ptrVal) = uint16(u64)
+	case reflect.Uint32:
+		if u64 > math.MaxUint32 {
+			return strconv.ErrRange
+		}
+		*(*uint32)(ptrVal) = uint32(u64)
+	case reflect.Uint64, reflect.Uintptr:
+		*(*uint64)(ptrVal) = u64
+	case reflect.Float32:
+		*(*float32)(ptrVal) = float32(u64)
+	case reflect.Float64:
+		*(*float64)(ptrVal) = float64(u64)
+	default:
+		if u64 > math.MaxInt64 {
+			return strconv.ErrRange
+		}
+		return setInt(dk, ptrVal, int64(u64))
+	}
+	return nil
+}
+
+// setFloat stores f64 into a number of kind dk, integers are truncated toward zero
+func setFloat(dk reflect.Kind, ptrVal unsafe.Pointer, f64 float64) error {
+	switch dk {
+	case reflect.Float32:
+		if math.Abs(f64) > math.MaxFloat32 && !math.IsInf(f64, 0) {
+			return strconv.ErrRange
+		}
+		*(*float32)(ptrVal) = float32(f64)
+		return nil
+	case reflect.Float64:
+		*(*float64)(ptrVal) = f64
+		return nil
+	}
+	f64 = math.Trunc(f64)
+	if math.IsNaN(f64) {
+		return strconv.ErrSyntax
+	}
+	if dk >= reflect.Uint && dk <= reflect.Uintptr {
+		// 1<<64 is the first float64 out of range
+		if f64 < 0 || f64 >= 1<<64 {
+			return strconv.ErrRange
+		}
+		return setUint(dk, ptrVal, uint64(f64))
+	}
+	if f64 < math.MinInt64 || f64 >= 1<<63 {
+		return strconv.ErrRange
+	}
+	return setInt(dk, ptrVal, int64(f64))
+}
+
+// setNumber converts a numeric driver value into a number of kind dk
+func setNumber(dk reflect.Kind, ptrVal unsafe.Pointer, src interface{}) error {
+	rv := reflect.ValueOf(src)
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return setInt(dk, ptrVal, 1)
+		}
+		return setInt(dk, ptrVal, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return setInt(dk, ptrVal, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return setUint(dk, ptrVal, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return setFloat(dk, ptrVal, rv.Float())
+	}
+	return strconv.ErrSyntax
+}
+
 type scanner struct {
-	Type reflect2.Type
-	Val  unsafe.Pointer
+	Type  reflect2.Type
+	Val   unsafe.Pointer
+	JSON  bool  // column holds JSON to unmarshal into Val
+	Valid *bool // set if the column is not NULL
+}
+
+// JSONCodec marshals and unmarshals fields tagged with the json option, e.g. jsoniter.ConfigCompatibleWithStandardLibrary
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+var _jsonCodec JSONCodec = stdJSONCodec{}
+
+// SetJSONCodec replaces encoding/json for json tagged fields, nil restores it. It is not synchronized,
+// call it during initialization, before any query runs
+func SetJSONCodec(c JSONCodec) {
+	if c == nil {
+		c = stdJSONCodec{}
+	}
+	_jsonCodec = c
+}
+
+type jsonValue struct {
+	v interface{}
+}
+
+// JSON wraps a value to be marshalled as a JSON column, e.g. in V or OnDuplicateKeyUpdate
+func JSON(v interface{}) driver.Valuer {
+	return jsonValue{v: v}
+}
+
+// Value marshals the wrapped value, nil pointers, maps and slices become NULL
+func (j jsonValue) Value() (driver.Value, error) {
+	rv := reflect.ValueOf(j.v)
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	}
+	b, err := _jsonCodec.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (dest *scanner) scanJSON(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		data = []byte(fmt.Sprint(v))
+	}
+
+	// reset first, so that maps are not merged with previous rows
+	dest.Type.UnsafeSet(dest.Val, dest.Type.UnsafeNew())
+	if len(data) == 0 {
+		return nil
+	}
+	return _jsonCodec.Unmarshal(data, dest.Type.PackEFace(dest.Val))
 }
 
 func numberToString(k reflect.Kind, src interface{}) string {
@@ -2426,6 +3798,8 @@ func numberToString(k reflect.Kind, src interface{}) string {
 		return "false"
 	case reflect.Int64:
 		return fmt.Sprintf("%d", src.(int64))
+	case reflect.Uint64:
+		return strconv.FormatUint(src.(uint64), 10)
 	case reflect.Float64:
 		return fmt.Sprintf("%g", src.(float64))
 	}
@@ -2503,131 +3877,50 @@ func scanFromString(isTime bool, st reflect2.Type, dt reflect2.Type, ptrVal unsa
 		}
 
 		// For numeric types, first try to parse time string
-		parsedTime, err := parseTimeString(tmp)
-		if err == nil {
-			ts := parsedTime.Unix()
-			switch dk {
-			case reflect.Int:
-				*(*int)(ptrVal) = int(ts)
-			case reflect.Int8:
-				*(*int8)(ptrVal) = int8(ts)
-			case reflect.Int16:
-				*(*int16)(ptrVal) = int16(ts)
-			case reflect.Int32:
-				*(*int32)(ptrVal) = int32(ts)
-			case reflect.Int64:
-				*(*int64)(ptrVal) = ts
-			case reflect.Uint:
-				*(*uint)(ptrVal) = uint(ts)
-			case reflect.Uint8:
-				*(*uint8)(ptrVal) = uint8(ts)
-			case reflect.Uint16:
-				*(*uint16)(ptrVal) = uint16(ts)
-			case reflect.Uint32:
-				*(*uint32)(ptrVal) = uint32(ts)
-			case reflect.Uint64:
-				*(*uint64)(ptrVal) = uint64(ts)
-			case reflect.Float32:
-				*(*float32)(ptrVal) = float32(ts)
-			case reflect.Float64:
-				*(*float64)(ptrVal) = float64(ts)
+		if parsedTime, err := parseTimeString(tmp); err == nil {
+			if err := setInt(dk, ptrVal, parsedTime.Unix()); err != nil {
+				return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
 			}
 			return nil
 		}
 
 		// If time parsing fails, try to parse directly as number
-		// For float types, use ParseFloat
 		if dk == reflect.Float32 || dk == reflect.Float64 {
 			f64, err := strconv.ParseFloat(tmp, 64)
+			if err == nil {
+				err = setFloat(dk, ptrVal, f64)
+			}
 			if err != nil {
 				return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
 			}
-			if dk == reflect.Float32 {
-				*(*float32)(ptrVal) = float32(f64)
-			} else {
-				*(*float64)(ptrVal) = f64
-			}
 			return nil
 		}
 
-		// For integer types, use ParseInt
-		i64, err := strconv.ParseInt(tmp, 10, 64)
-		if err != nil {
-			return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
-		}
-		switch dk {
-		case reflect.Int:
-			*(*int)(ptrVal) = int(i64)
-		case reflect.Int8:
-			*(*int8)(ptrVal) = int8(i64)
-		case reflect.Int16:
-			*(*int16)(ptrVal) = int16(i64)
-		case reflect.Int32:
-			*(*int32)(ptrVal) = int32(i64)
-		case reflect.Int64:
-			*(*int64)(ptrVal) = i64
-		case reflect.Uint:
-			*(*uint)(ptrVal) = uint(i64)
-		case reflect.Uint8:
-			*(*uint8)(ptrVal) = uint8(i64)
-		case reflect.Uint16:
-			*(*uint16)(ptrVal) = uint16(i64)
-		case reflect.Uint32:
-			*(*uint32)(ptrVal) = uint32(i64)
-		case reflect.Uint64:
-			*(*uint64)(ptrVal) = uint64(i64)
-		}
-		return nil
-	}
-
-	// Non-time format
-	switch dk {
-	case reflect.Bool:
-		*(*bool)(ptrVal) = (tmp == "true")
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i64, err := strconv.ParseInt(tmp, 10, dt.Type1().Bits())
-		if err != nil {
-			return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
-		}
-		switch dk {
-		case reflect.Int64:
-			*(*int64)(ptrVal) = i64
-		case reflect.Int32:
-			*(*int32)(ptrVal) = int32(i64)
-		case reflect.Int16:
-			*(*int16)(ptrVal) = int16(i64)
-		case reflect.Int8:
-			*(*int8)(ptrVal) = int8(i64)
-		case reflect.Int:
-			*(*int)(ptrVal) = int(i64)
-		}
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		u64, err := strconv.ParseUint(tmp, 10, dt.Type1().Bits())
-		if err != nil {
-			return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
+		// For integer types, parse with the sign of the destination
+		if dk >= reflect.Uint {
+			u64, err := strconv.ParseUint(tmp, 10, 64)
+			if err == nil {
+				err = setUint(dk, ptrVal, u64)
+			}
+			if err != nil {
+				return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
+			}
+			return nil
 		}
-		switch dk {
-		case reflect.Uint64:
-			*(*uint64)(ptrVal) = u64
-		case reflect.Uint32:
-			*(*uint32)(ptrVal) = uint32(u64)
-		case reflect.Uint16:
-			*(*uint16)(ptrVal) = uint16(u64)
-		case reflect.Uint8:
-			*(*uint8)(ptrVal) = uint8(u64)
-		case reflect.Uint:
-			*(*uint)(ptrVal) = uint(u64)
+		i64, err := strconv.ParseInt(tmp, 10, 64)
+		if err == nil {
+			err = setInt(dk, ptrVal, i64)
 		}
-	case reflect.Float32, reflect.Float64:
-		f64, err := strconv.ParseFloat(tmp, dt.Type1().Bits())
 		if err != nil {
-			return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
-		}
-		if dk == reflect.Float32 {
-			*(*float32)(ptrVal) = float32(f64)
-		} else {
-			*(*float64)(ptrVal) = f64
+			return fmt.Errorf("converting driver.Value type %s (%s) to a %s: %v", st.String(), tmp, dk, strconvErr(err))
 		}
+		return nil
+	}
+
+	// Non-time format
+	switch dk {
+	case reflect.Bool:
+		*(*bool)(ptrVal) = (tmp == "true")
 	case reflect.String:
 		*(*string)(ptrVal) = tmp
 	default:
@@ -2648,6 +3941,30 @@ func (dest *scanner) Scan(src interface{}) error {
 		dt = dest.Type
 	)
 
+	if dest.Valid != nil && src != nil {
+		*dest.Valid = true
+	}
+
+	if dest.JSON {
+		return dest.scanJSON(src)
+	}
+
+	// sql.Scanner, either on the field or on what a pointer field points to
+	if sc, ok := dt.PackEFace(dest.Val).(sql.Scanner); ok {
+		return sc.Scan(src)
+	}
+	if dt.Kind() == reflect.Ptr {
+		et := dt.(reflect2.PtrType).Elem()
+		if _, ok := et.PackEFace(nil).(sql.Scanner); ok && src != nil {
+			v := et.UnsafeNew()
+			if err := et.PackEFace(v).(sql.Scanner).Scan(src); err != nil {
+				return err
+			}
+			*(*unsafe.Pointer)(dest.Val) = v
+			return nil
+		}
+	}
+
 	// NULL value
 	if src == nil {
 		// If it's a pointer type, set to nil
@@ -2706,36 +4023,24 @@ func (dest *scanner) Scan(src interface{}) error {
 		return dest.Scan(src.(time.Time).Unix())
 	}
 
+	// number => number, overflow checked
+	if isNumberKind(dk) && (isNumberKind(sk) || sk == reflect.Bool) {
+		if err := setNumber(dk, dest.Val, src); err != nil {
+			return fmt.Errorf("converting driver.Value type %s (%v) to a %s: %v", st.String(), src, dk, err)
+		}
+		return nil
+	}
+
 	switch dk {
 	case reflect.Bool:
 		switch sk {
 		case reflect.Int64:
 			*(*bool)(dest.Val) = (src.(int64) != 0)
+		case reflect.Uint64:
+			*(*bool)(dest.Val) = (src.(uint64) != 0)
 		case reflect.Float64:
 			*(*bool)(dest.Val) = (src.(float64) != 0)
 		}
-	case reflect.Int64:
-		switch sk {
-		case reflect.Bool:
-			if src.(bool) {
-				*(*int64)(dest.Val) = int64(1)
-			} else {
-				*(*int64)(dest.Val) = int64(0)
-			}
-		case reflect.Float64:
-			*(*int64)(dest.Val) = int64(src.(float64))
-		}
-	case reflect.Float64:
-		switch sk {
-		case reflect.Bool:
-			if src.(bool) {
-				*(*float64)(dest.Val) = float64(1)
-			} else {
-				*(*float64)(dest.Val) = float64(0)
-			}
-		case reflect.Int64:
-			*(*float64)(dest.Val) = float64(src.(int64))
-		}
 	case reflect.String:
 		*(*string)(dest.Val) = numberToString(sk, src)
 	default:
@@ -2750,9 +4055,12 @@ func (dest *scanner) Scan(src interface{}) error {
 }
 
 type ormCond struct {
-	Field string
-	Op    string
-	Args  []interface{}
+	Field  string
+	Op     string
+	Args   []interface{}
+	orForm *ormCondEx // InTuple for dialects without row values
+	tuple  *tupleRows // InTuple, resolved again with the columns of the table
+	err    error      // failed to build, reported by the statement
 }
 
 func (c *ormCond) Type() int {
@@ -2784,6 +4092,13 @@ func (cx *ormCondEx) Type() int {
 }
 
 func (cx *ormCondEx) BuildSQL(sb *strings.Builder) {
+	if cx.Ty == _notCondEx {
+		// Not always groups its operand, so the precedence never depends on the context
+		sb.WriteString("not (")
+		(&ormCondEx{Ty: _andCondEx, Conds: cx.Conds}).BuildSQL(sb)
+		sb.WriteString(")")
+		return
+	}
 	for i, c := range cx.Conds {
 		if i > 0 {
 			switch cx.Ty {
@@ -2842,39 +4157,56 @@ func Or(conds ...interface{}) *ormCondEx {
 	return &ormCondEx{Ty: _orCondEx, Conds: conds}
 }
 
+// Not negates the condition, e.g. Not(Or(Eq("x", x), Eq("y", y)))
+func Not(cond interface{}) *ormCondEx {
+	if condEx, ok := cond.(*ormCondEx); ok && len(condEx.Conds) <= 0 {
+		// an empty group is always true
+		return &ormCondEx{Ty: _andCondEx, Conds: []interface{}{&ormCond{Op: "1=0"}}}
+	}
+	return &ormCondEx{Ty: _notCondEx, Conds: []interface{}{cond}}
+}
+
 // Cond .
 func Cond(c string, args ...interface{}) *ormCond {
 	return &ormCond{Op: c, Args: args}
 }
 
+// compare builds `field op ?`, or `field op (select ...)` for a sub-query
+func compare(field, op string, i interface{}) *ormCond {
+	if sq, ok := i.(*subQuery); ok {
+		return sq.cond(field, op)
+	}
+	return &ormCond{Field: field, Op: op + "?", Args: []interface{}{i}}
+}
+
 // Eq .
 func Eq(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: "=?", Args: []interface{}{i}}
+	return compare(field, "=", i)
 }
 
 // Neq .
 func Neq(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: "<>?", Args: []interface{}{i}}
+	return compare(field, "<>", i)
 }
 
 // Gt .
 func Gt(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: ">?", Args: []interface{}{i}}
+	return compare(field, ">", i)
 }
 
 // Gte .
 func Gte(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: ">=?", Args: []interface{}{i}}
+	return compare(field, ">=", i)
 }
 
 // Lt .
 func Lt(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: "<?", Args: []interface{}{i}}
+	return compare(field, "<", i)
 }
 
 // Lte .
 func Lte(field string, i interface{}) *ormCond {
-	return &ormCond{Field: field, Op: "<=?", Args: []interface{}{i}}
+	return compare(field, "<=", i)
 }
 
 // Between .
@@ -2882,26 +4214,87 @@ func Between(field string, i interface{}, j interface{}) *ormCond {
 	return &ormCond{Field: field, Op: " between ? and ?", Args: []interface{}{i, j}}
 }
 
+// NotBetween .
+func NotBetween(field string, i interface{}, j interface{}) *ormCond {
+	return &ormCond{Field: field, Op: " not between ? and ?", Args: []interface{}{i, j}}
+}
+
 // Like .
 func Like(field string, pattern string) *ormCond {
 	return &ormCond{Field: field, Op: " like ?", Args: []interface{}{pattern}}
 }
 
-// In .
+// NotLike .
+func NotLike(field string, pattern string) *ormCond {
+	return &ormCond{Field: field, Op: " not like ?", Args: []interface{}{pattern}}
+}
+
+// IsNull .
+func IsNull(field string) *ormCond {
+	return &ormCond{Field: field, Op: " is null"}
+}
+
+// IsNotNull .
+func IsNotNull(field string) *ormCond {
+	return &ormCond{Field: field, Op: " is not null"}
+}
+
+// InOption changes how In/NotIn treat their values, pass it after the values
+type InOption int
+
+const (
+	// EmptyInMatchAll makes In with no values match every row instead of none (the old behavior)
+	EmptyInMatchAll InOption = iota + 1
+)
+
+// In - with no values it matches nothing (1=0), unless EmptyInMatchAll is passed
 func In(field string, args ...interface{}) *ormCond {
+	args, opts := splitInOptions(args)
+	if opts[EmptyInMatchAll] {
+		return inCond(field, " in ", "1=1", args)
+	}
+	return inCond(field, " in ", "1=0", args)
+}
+
+// NotIn - with no values it matches everything (1=1)
+func NotIn(field string, args ...interface{}) *ormCond {
+	args, _ = splitInOptions(args)
+	return inCond(field, " not in ", "1=1", args)
+}
+
+func splitInOptions(args []interface{}) ([]interface{}, map[InOption]bool) {
+	var opts map[InOption]bool
+	for len(args) > 0 {
+		o, ok := args[len(args)-1].(InOption)
+		if !ok {
+			break
+		}
+		if opts == nil {
+			opts = make(map[InOption]bool)
+		}
+		opts[o] = true
+		args = args[:len(args)-1]
+	}
+	return args, opts
+}
+
+func inCond(field, op, empty string, args []interface{}) *ormCond {
 RETRY:
 	switch len(args) {
 	case 0:
-		return &ormCond{Op: "1=1"}
+		return &ormCond{Op: empty}
 	case 1:
+		if sq, ok := args[0].(*subQuery); ok {
+			return sq.cond(field, op)
+		}
 		rt := reflect2.TypeOf(args[0])
 		// If the first argument is an array, convert to interface array
 		if rt.Kind() == reflect.Slice {
-			len := rt.(reflect2.SliceType).UnsafeLengthOf(reflect2.PtrOf(args[0]))
-			argsAux := make([]interface{}, len)
-			rtElem := rt.(reflect2.ListType).Elem()
-			for i := 0; i < len; i++ {
-				argsAux[i] = rtElem.PackEFace(rt.(reflect2.ListType).UnsafeGetIndex(reflect2.PtrOf(args[0]), i))
+			rv := reflect.ValueOf(args[0])
+			argsAux := make([]interface{}, rv.Len())
+			for i := range argsAux {
+				// copy the element, packing its address would alias the slice and add a level of pointer
+				argsAux[i] = rv.Index(i).Interface()
 			}
 			args = argsAux
 			goto RETRY
@@ -2910,13 +4303,15 @@ RETRY:
 			// This ensures cache consistency in Reuse mode and avoids SQL shape variations
 			// The performance difference between IN (?) and = ? is minimal
 			var sb strings.Builder
-			sb.WriteString(" in (?)")
+			sb.WriteString(op)
+			sb.WriteString("(?)")
 			return &ormCond{Field: field, Op: sb.String(), Args: args}
 		}
 	}
 
 	var sb strings.Builder
-	sb.WriteString(" in (")
+	sb.WriteString(op)
+	sb.WriteString("(")
 	for i := 0; i < len(args); i++ {
 		if i > 0 {
 			sb.WriteString(",")
@@ -2927,16 +4322,474 @@ RETRY:
 	return &ormCond{Field: field, Op: sb.String(), Args: args}
 }
 
+// InTuple - `(a,b) in ((?,?),(?,?))`, rows is a slice of structs, slices or maps(V) holding the fields
+func InTuple(fields []string, rows interface{}) *ormCond {
+	return _tupleTable.inTuple(&tupleRows{Fields: fields, Rows: reflect.ValueOf(rows)})
+}
+
+// _tupleTable resolves the columns of InTuple outside of a statement, like in a SubQuery
+var _tupleTable = Table(nil, "")
+
+type tupleRows struct {
+	Fields []string
+	Rows   reflect.Value
+}
+
+// inTuple builds InTuple with the columns of struct rows as the table sees them
+func (t *BormTable) inTuple(tr *tupleRows) *ormCond {
+	fail := func(err error) *ormCond {
+		return &ormCond{Op: "1=0", tuple: tr, err: err}
+	}
+
+	rv := reflect.Indirect(tr.Rows)
+	if !rv.IsValid() {
+		return &ormCond{Op: "1=0", tuple: tr}
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fail(fmt.Errorf("InTuple: rows should be a slice, not %s", rv.Type()))
+	}
+	if rv.Len() <= 0 {
+		return &ormCond{Op: "1=0", tuple: tr}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("(")
+	for i, field := range tr.Fields {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fieldEscape(&sb, field)
+	}
+	sb.WriteString(") in (")
+
+	cond := &ormCond{orForm: &ormCondEx{Ty: _orCondEx}, tuple: tr}
+	for i := 0; i < rv.Len(); i++ {
+		vals, err := t.tupleValues(tr.Fields, rv.Index(i))
+		if err != nil {
+			return fail(err)
+		}
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("(")
+		and := &ormCondEx{Ty: _andCondEx}
+		for j, v := range vals {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("?")
+			and.Conds = append(and.Conds, Eq(tr.Fields[j], v))
+		}
+		sb.WriteString(")")
+		cond.Args = append(cond.Args, vals...)
+		cond.orForm.Conds = append(cond.orForm.Conds, and)
+	}
+	sb.WriteString(")")
+	cond.Op = sb.String()
+	return cond
+}
+
+func (t *BormTable) tupleValues(fields []string, row reflect.Value) ([]interface{}, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	vals := make([]interface{}, len(fields))
+	switch row.Kind() {
+	case reflect.Struct:
+		if !row.CanAddr() {
+			c := reflect.New(row.Type()).Elem()
+			c.Set(row)
+			row = c
+		}
+		m := t.getStructFieldMap(reflect2.Type2(row.Type()).(reflect2.StructType))
+		for i, field := range fields {
+			c := m[field]
+			if c == nil {
+				return nil, fmt.Errorf("InTuple: no field %s in %s", field, row.Type())
+			}
+			f := c.Field
+			vals[i] = reflect.NewAt(f.Type().Type1(), f.UnsafeGet(unsafe.Pointer(row.UnsafeAddr()))).Elem().Interface()
+		}
+	case reflect.Slice, reflect.Array:
+		if row.Len() != len(fields) {
+			return nil, fmt.Errorf("InTuple: row of %d values for %d fields", row.Len(), len(fields))
+		}
+		for i := range fields {
+			vals[i] = row.Index(i).Interface()
+		}
+	case reflect.Map:
+		for i, field := range fields {
+			v := row.MapIndex(reflect.ValueOf(field).Convert(row.Type().Key()))
+			if !v.IsValid() {
+				return nil, fmt.Errorf("InTuple: no key %s in row", field)
+			}
+			vals[i] = v.Interface()
+		}
+	default:
+		return nil, fmt.Errorf("InTuple: unsupported row type %s", row.Type())
+	}
+	return vals, nil
+}
+
+// Exists .
+func Exists(sq *subQuery) *ormCond {
+	return sq.cond("", "exists ")
+}
+
+// NotExists .
+func NotExists(sq *subQuery) *ormCond {
+	return sq.cond("", "not exists ")
+}
+
+/*
+   Sub-queries
+*/
+
+type subQuery struct {
+	SQL     string
+	Args    []interface{}
+	ordered bool  // has order by or limit, so it needs parentheses in a union
+	err     error // a condition failed to build, reported by the statement using it
+}
+
+// SubQuery builds `select ... from table ...` from the same items as Select, for In/Exists/Eq... and Fields(...).Scalar
+func SubQuery(table string, args ...BormItem) *subQuery {
+	sq := &subQuery{}
+	var sb strings.Builder
+	sb.WriteString("select ")
+	writeOptimizerHints(&sb, args)
+	if len(args) > 0 && args[0].Type() == _fields {
+		args[0].BuildSQL(&sb)
+		args[0].BuildArgs(&sq.Args)
+		args = args[1:]
+	} else {
+		sb.WriteString("*")
+	}
+	sb.WriteString(" from ")
+	fieldEscape(&sb, table)
+	for _, arg := range mergeSelectArgs(args) {
+		arg.BuildSQL(&sb)
+		arg.BuildArgs(&sq.Args)
+		sq.ordered = sq.ordered || arg.Type() == _orderBy || arg.Type() == _limit
+		if sq.err == nil {
+			sq.err = argErr(arg)
+		}
+	}
+	sq.SQL = sb.String()
+	return sq
+}
+
+// Union selects from the union of the sub-queries instead of the table, whose name becomes the alias:
+// Table(db, "feed").Select(&o, Union(SubQuery("t_a", ...), SubQuery("t_b", ...)), OrderBy("ctime desc"), Limit(20))
+func Union(sqs ...*subQuery) *unionItem {
+	return &unionItem{Parts: sqs}
+}
+
+// UnionAll is Union keeping duplicate rows
+func UnionAll(sqs ...*subQuery) *unionItem {
+	return &unionItem{All: true, Parts: sqs}
+}
+
+type unionItem struct {
+	All   bool
+	Parts []*subQuery
+}
+
+func (u *unionItem) Type() int {
+	return _union
+}
+
+func (u *unionItem) BuildSQL(sb *strings.Builder) {
+	sb.WriteString("(")
+	for i, sq := range u.Parts {
+		if i > 0 {
+			if u.All {
+				sb.WriteString(" union all ")
+			} else {
+				sb.WriteString(" union ")
+			}
+		}
+		if sq.ordered {
+			sq.BuildSQL(sb)
+		} else {
+			sb.WriteString(sq.SQL)
+		}
+	}
+	sb.WriteString(")")
+}
+
+func (u *unionItem) BuildArgs(stmtArgs *[]interface{}) {
+	for _, sq := range u.Parts {
+		sq.BuildArgs(stmtArgs)
+	}
+}
+
+// With prefixes the statement with `with name as (q)`, q is a SubQuery or a Union,
+// name can list the columns, e.g. With("tree(id,pid)", ...)
+func With(name string, q withQuery) *withItem {
+	return &withItem{Name: name, Query: q}
+}
+
+// WithRecursive is With for a recursive q, usually UnionAll(anchor, SubQuery(...) joined with name)
+func WithRecursive(name string, q withQuery) *withItem {
+	return &withItem{Name: name, Query: q, Recursive: true}
+}
+
+type withQuery interface {
+	BuildSQL(*strings.Builder)
+	BuildArgs(*[]interface{})
+}
+
+type withItem struct {
+	Name      string
+	Query     withQuery
+	Recursive bool
+}
+
+func (w *withItem) Type() int {
+	return _with
+}
+
+func (w *withItem) BuildSQL(sb *strings.Builder) {
+	fieldEscape(sb, w.Name)
+	sb.WriteString(" as ")
+	w.Query.BuildSQL(sb)
+}
+
+func (w *withItem) BuildArgs(stmtArgs *[]interface{}) {
+	w.Query.BuildArgs(stmtArgs)
+}
+
+// cteDB prefixes every statement with the common table expressions and their args
+type cteDB struct {
+	BormDBIFace
+	prefix string
+	args   []interface{}
+}
+
+func (c *cteDB) with(query string, args []interface{}) (string, []interface{}) {
+	return c.prefix + query, append(append([]interface{}(nil), c.args...), args...)
+}
+
+func (c *cteDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query, args = c.with(query, args)
+	return c.BormDBIFace.QueryRowContext(ctx, query, args...)
+}
+
+func (c *cteDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = c.with(query, args)
+	return c.BormDBIFace.QueryContext(ctx, query, args...)
+}
+
+func (c *cteDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args = c.with(query, args)
+	return c.BormDBIFace.ExecContext(ctx, query, args...)
+}
+
+// withCTE takes the With items out of args, and returns a table running its statements after them
+func (t *BormTable) withCTE(args []BormItem) (*BormTable, []BormItem) {
+	var (
+		withs []*withItem
+		rest  []BormItem
+	)
+	for _, arg := range args {
+		if w, ok := arg.(*withItem); ok {
+			withs = append(withs, w)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(withs) <= 0 {
+		return t, args
+	}
+
+	db := &cteDB{BormDBIFace: t.DB}
+	var sb strings.Builder
+	sb.WriteString("with ")
+	for _, w := range withs {
+		if w.Recursive {
+			sb.WriteString("recursive ")
+			break
+		}
+	}
+	for i, w := range withs {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		w.BuildSQL(&sb)
+		w.BuildArgs(&db.args)
+	}
+	sb.WriteString(" ")
+	db.prefix = sb.String()
+
+	if t.Cfg.Debug {
+		log.Println(db.prefix, db.args)
+	}
+	return t.derive(db), rest
+}
+
+// selectUnion returns the Union item of a Select, if any
+func selectUnion(args []BormItem) BormItem {
+	for _, arg := range args {
+		if arg.Type() == _union {
+			return arg
+		}
+	}
+	return nil
+}
+
+func (sq *subQuery) BuildSQL(sb *strings.Builder) {
+	sb.WriteString("(")
+	sb.WriteString(sq.SQL)
+	sb.WriteString(")")
+}
+
+func (sq *subQuery) BuildArgs(stmtArgs *[]interface{}) {
+	*stmtArgs = append(*stmtArgs, sq.Args...)
+}
+
+func (sq *subQuery) cond(field, op string) *ormCond {
+	var sb strings.Builder
+	sb.WriteString(op)
+	sq.BuildSQL(&sb)
+	return &ormCond{Field: field, Op: sb.String(), Args: append([]interface{}(nil), sq.Args...), err: sq.err}
+}
+
 /*
 	data-binding related
 */
 
 // DataBindingItem .
 type DataBindingItem struct {
-	SQL  string
-	Cols []interface{}
-	Type reflect2.Type
-	Elem interface{}
+	SQL    string
+	Cols   []interface{}
+	Type   reflect2.Type
+	Elem   interface{}
+	Nested []*nestedPtr
+	fields []*structColumn // the struct columns of Cols, for bind
+}
+
+// addCol adds the scanner of the column c of item.Elem
+func (item *DataBindingItem) addCol(c *structColumn) {
+	item.Cols = append(item.Cols, item.scannerOf(c))
+	item.fields = append(item.fields, c)
+}
+
+// bind returns an item with the SQL of the cached item, scanning into elem
+func (item *DataBindingItem) bind(elem interface{}) *DataBindingItem {
+	b := &DataBindingItem{SQL: item.SQL, Type: item.Type, Elem: elem}
+	if item.Type.Kind() != reflect.Struct {
+		b.Cols = []interface{}{&scanner{Type: item.Type, Val: reflect2.PtrOf(elem)}}
+		return b
+	}
+	for _, c := range item.fields {
+		b.addCol(c)
+	}
+	return b
+}
+
+// nestedPtr is a pointer to a nested struct field tagged `alias.*`, its columns are scanned into Scratch
+type nestedPtr struct {
+	Field   reflect2.StructField
+	Slot    unsafe.Pointer // the pointer field, in item.Elem or the Scratch of Parent
+	Parent  *nestedPtr     // the nested pointer the field is under, if any
+	Type    reflect2.Type  // the struct pointed to
+	Scratch unsafe.Pointer
+	Zero    unsafe.Pointer
+	Valid   bool // some column is not NULL
+}
+
+// fillNested points the nested pointer fields to a copy of what was scanned, or nil if all columns were NULL,
+// innermost first so that they are copied along with their parents
+func (item *DataBindingItem) fillNested() {
+	for i := len(item.Nested) - 1; i >= 0; i-- {
+		np := item.Nested[i]
+		var p unsafe.Pointer
+		if np.Valid {
+			p = np.Type.UnsafeNew()
+			np.Type.UnsafeSet(p, np.Scratch)
+			if np.Parent != nil {
+				np.Parent.Valid = true
+			}
+		}
+		*(*unsafe.Pointer)(np.Slot) = p
+		np.Type.UnsafeSet(np.Scratch, np.Zero)
+		np.Valid = false
+	}
+}
+
+// scannerOf returns the scanner of the column c of item.Elem
+func (item *DataBindingItem) scannerOf(c *structColumn) *scanner {
+	val, np := item.target(c.Field)
+	sc := &scanner{Type: c.Field.Type(), Val: val, JSON: c.Opts.Contains("json")}
+	if np != nil {
+		sc.Valid = &np.Valid
+	}
+	return sc
+}
+
+// target returns where the field f of item.Elem is scanned into, and the nested pointer it is under if any,
+// fields under nested pointers are scanned into scratch structs, allocated by fillNested if not all NULL
+func (item *DataBindingItem) target(f reflect2.StructField) (unsafe.Pointer, *nestedPtr) {
+	inf, ok := f.(*inlineField)
+	if !ok {
+		return f.UnsafeGet(reflect2.PtrOf(item.Elem)), nil
+	}
+	base, np := item.target(inf.Parent)
+	if inf.Parent.Type().Kind() == reflect.Ptr {
+		np = item.nested(inf.Parent, base, np)
+		base = np.Scratch
+	}
+	return inf.StructField.UnsafeGet(base), np
+}
+
+// nested returns the nestedPtr of the pointer field f at slot, added on first use
+func (item *DataBindingItem) nested(f reflect2.StructField, slot unsafe.Pointer, parent *nestedPtr) *nestedPtr {
+	for _, np := range item.Nested {
+		if np.Field == f {
+			return np
+		}
+	}
+	et := f.Type().(reflect2.PtrType).Elem()
+	np := &nestedPtr{Field: f, Slot: slot, Parent: parent, Type: et, Scratch: et.UnsafeNew(), Zero: et.UnsafeNew()}
+	item.Nested = append(item.Nested, np)
+	return np
+}
+
+// reuseKey is the key of the statement cached for a call site, made of what its SQL depends on:
+// the operation, the table and its config, the type of obj and the columns of its struct, and the shape of args
+func (t *BormTable) reuseKey(callSite *CallSite, op string, obj interface{}, args []BormItem) string {
+	var b strings.Builder
+	b.WriteString(op)
+	b.WriteString("|")
+	b.WriteString(t.Name)
+	if rt := reflect2.TypeOf(obj); rt != nil {
+		b.WriteString("|")
+		b.WriteString(strconv.FormatUint(uint64(rt.RType()), 16))
+		for rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Slice {
+			if rt.Kind() == reflect.Ptr {
+				rt = rt.(reflect2.PtrType).Elem()
+			} else {
+				rt = rt.(reflect2.SliceType).Elem()
+			}
+		}
+		if s, ok := rt.(reflect2.StructType); ok {
+			b.WriteString("|")
+			b.WriteString(t.structFields(s).Key)
+		}
+	}
+	b.WriteString("|")
+	b.WriteString(t.qualifier())
+	b.WriteString("|")
+	b.WriteString(strconv.FormatBool(t.Cfg.ToTimestamp))
+	b.WriteString("|")
+	b.WriteString(strconv.FormatBool(t.Cfg.Unscoped))
+	b.WriteString("|")
+	b.WriteString(t.dialectKey())
+	if sd := t.Cfg.softDelete; sd != nil {
+		fmt.Fprintf(&b, "|%v", *sd)
+	}
+	return buildShapeKey(callSite.Key, b.String(), args)
 }
 
 // buildShapeKey builds reuse key based on call site key and parameter shape
@@ -2967,24 +4820,42 @@ func buildCacheKey(file string, line int) string {
 	return key
 }
 
+// getCallSite returns where the borm API was called from, the first frame outside borm's own source files
 func getCallSite() *CallSite {
-	pc := make([]uintptr, 1)
-	runtime.Callers(2, pc) // Skip getCallSite and caller
-	callerPC := pc[0]
+	var pcs [16]uintptr
+	n := runtime.Callers(2, pcs[:]) // Skip getCallSite
+	for _, pc := range pcs[:n] {
+		if cached, ok := _callSiteCache.Load(pc); ok {
+			if callSite := cached.(*CallSite); callSite != nil {
+				return callSite
+			}
+			continue
+		}
 
-	if cached, ok := _callSiteCache.Load(callerPC); ok {
-		return cached.(*CallSite)
+		// nil for the frames in borm, all frames inlined at pc included
+		var callSite *CallSite
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+			if !isBormFile(frame.File) {
+				callSite = &CallSite{File: frame.File, Line: frame.Line, Key: buildCacheKey(frame.File, frame.Line)}
+				break
+			}
+			if !more {
+				break
+			}
+		}
+		_callSiteCache.Store(pc, callSite)
+		if callSite != nil {
+			return callSite
+		}
 	}
+	return &CallSite{}
+}
 
-	_, file, line, _ := runtime.Caller(1)
-	key := buildCacheKey(file, line)
-	callSite := &CallSite{
-		File: file,
-		Line: line,
-		Key:  key,
-	}
-	_callSiteCache.Store(callerPC, callSite)
-	return callSite
+// isBormFile reports whether file is a source file of borm, but its tests
+func isBormFile(file string) bool {
+	return path.Dir(file) == _bormDir && !strings.HasSuffix(file, "_test.go")
 }
 
 func storeToCache(file string, line int, item *DataBindingItem) {
@@ -3014,8 +4885,12 @@ func loadFromCacheOptimized(callSite *CallSite) *DataBindingItem {
 
 var (
 	_dataBindingCache sync.Map
-	_callSiteCache    sync.Map // map[uintptr]*CallSite
-	_cacheKeyPool     = sync.Pool{
+	_callSiteCache    sync.Map // map[uintptr]*CallSite, nil for pcs in borm
+	_bormDir          = func() string {
+		_, file, _, _ := runtime.Caller(0)
+		return path.Dir(file)
+	}()
+	_cacheKeyPool = sync.Pool{
 		New: func() interface{} {
 			return &strings.Builder{}
 		},
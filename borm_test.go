@@ -3,9 +3,13 @@ package borm
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,12 +27,39 @@ var db *sql.DB
 func init() {
 	var err error
 	// db, err = sql.Open("mysql", "root:@tcp(localhost:3306)/borm_test?charset=utf8mb4")
-	db, err = sql.Open("mysql", "root:semaphoredb@tcp(localhost:3306)/borm_test?charset=utf8mb4")
+	// e.g. BORM_TEST_MYSQL_DSN="root:semaphoredb@tcp(localhost:3306)/borm_test?charset=utf8mb4"
+	if dsn := os.Getenv("BORM_TEST_MYSQL_DSN"); dsn != "" {
+		db, err = sql.Open("mysql", dsn)
+	} else {
+		db, err = sql.Open(FakeDriverName, "borm_test")
+		if err == nil {
+			err = seedFakeDB(db)
+		}
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// seedFakeDB creates the tables and rows the tests expect to find in borm_test
+func seedFakeDB(db *sql.DB) error {
+	stmts := []string{
+		"create table `test` (`id` bigint not null auto_increment, `name` varchar(255) not null default '', `age` int not null default 0, `email` varchar(255) default '', `ctime` bigint not null default 0, `ctime2` datetime, `ctime3` datetime, `ctime4` datetime, primary key (`id`), key `idx_ctime` (`ctime`))",
+		"create table `test2` (`id` bigint not null auto_increment, `name` varchar(255) not null default '', `age` int not null default 0, primary key (`id`))",
+	}
+	for i := 1; i <= 5; i++ {
+		stmts = append(stmts,
+			fmt.Sprintf("insert into `test` (`name`,`age`,`ctime`,`ctime2`,`ctime3`,`ctime4`) values ('orca%d',%d,1551405784,'2019-03-01 02:03:04','2019-03-01 02:03:04','2019-03-01 02:03:04')", i, 28+i),
+			fmt.Sprintf("insert into `test2` (`name`,`age`) values ('orca%d',%d)", i, 28+i))
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type x struct {
 	X  string    `borm:"name"`
 	Y  int64     `borm:"age"`
@@ -95,6 +126,55 @@ func TestForceIndex(t *testing.T) {
 		So(n, ShouldBeGreaterThan, 1)
 		So(len(ids), ShouldBeGreaterThan, 1)
 	})
+
+	Convey("hints", t, func() {
+		c := NewBormCapture(db)
+		tbl := Table(c, "test")
+
+		var ids []int64
+		n, err := tbl.Select(&ids, Fields("id"), Where(Gt("id", 0)), OptimizerHint("MAX_EXECUTION_TIME(1000)", "NO_ICP(test)"),
+			IgnoreIndex("idx_ctime").ForOrderBy(), UseIndex("PRIMARY", "idx_ctime"), OrderBy("id"), Limit(2))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(c.Last().SQL, ShouldEqual, "select /*+ MAX_EXECUTION_TIME(1000) NO_ICP(test) */ `id` from `test` ignore index for order by (idx_ctime) use index(PRIMARY,idx_ctime) where `id`>? order by `id` limit ?")
+
+		var o []x
+		_, err = Table(c, "test").AutoQualify().Select(&o, Where(Gt("test.id", 0)), ForceIndex("PRIMARY").ForJoin(),
+			InnerJoin("test2", "t2", Cond("`t2`.`id`=`test`.`id`")).IndexHint(UseIndex().ForJoin(), IgnoreIndex("idx_x")), Limit(1))
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEndWith, " from `test` force index for join (PRIMARY) inner join `test2` as `t2` use index for join () ignore index(idx_x) on `t2`.`id`=`test`.`id` where test.id>? limit ?")
+
+		var m []map[string]interface{}
+		_, err = tbl.Select(&m, Fields("id"), ForceIndex("idx_ctime").ForGroupBy(), GroupBy("id"), OptimizerHint("BKA(test)"))
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEqual, "select /*+ BKA(test) */ `id` from `test` force index for group by (idx_ctime) group by `id`")
+	})
+
+	Convey("hints in update and delete", t, func() {
+		c, tbl := captureTable(t, "fake_hints", "t_usr")
+		_, err := tbl.Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}})
+		So(err, ShouldBeNil)
+
+		n, err := tbl.Update(V{"age": 19}, OptimizerHint("NO_ICP(t_usr)"), ForceIndex("PRIMARY"), Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(c.Last().SQL, ShouldEqual, "update /*+ NO_ICP(t_usr) */ `t_usr` force index(PRIMARY) set `age`=? where `id`=?")
+
+		n, err = tbl.Update(&fakeUser{Age: 21}, Fields("age"), UseIndex("uk_name"), Where(Eq("name", "Bob")))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(c.Last().SQL, ShouldEqual, "update `t_usr` use index(uk_name) set `age`=? where `name`=?")
+
+		n, err = tbl.Delete(OptimizerHint("BKA(t_usr)"), Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(c.Last().SQL, ShouldEqual, "delete /*+ BKA(t_usr) */ from `t_usr` where `id`=?")
+
+		before := len(c.Stmts())
+		_, err = tbl.Delete(ForceIndex("PRIMARY"), Where(Eq("id", 1)))
+		So(err, ShouldNotBeNil)
+		So(len(c.Stmts()), ShouldEqual, before)
+	})
 }
 
 func TestSelect(t *testing.T) {
@@ -400,7 +480,7 @@ func TestInsert(t *testing.T) {
 			}))
 
 			So(err, ShouldBeNil)
-			So(n, ShouldEqual, 1)
+			So(n, ShouldEqual, 2) // an updated row counts twice, as MySQL reports it
 		})
 
 		Convey("on duplicate key update with U", func() {
@@ -442,7 +522,7 @@ func TestInsert(t *testing.T) {
 			}))
 
 			So(err, ShouldBeNil)
-			So(n, ShouldEqual, 1)
+			So(n, ShouldEqual, 2) // an updated row counts twice, as MySQL reports it
 		})
 	})
 
@@ -463,6 +543,43 @@ func TestInsert(t *testing.T) {
 	})
 }
 
+// sqlRecorder is a BormDBIFace recording the SQL it is given without running it
+type sqlRecorder struct {
+	sqls []string
+}
+
+func (r *sqlRecorder) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	r.sqls = append(r.sqls, query)
+	return nil
+}
+
+func (r *sqlRecorder) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r.sqls = append(r.sqls, query)
+	return nil, errors.New("recorded")
+}
+
+func (r *sqlRecorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.sqls = append(r.sqls, query)
+	return nil, errors.New("recorded")
+}
+
+// TestInsertBatchSQL checks each row of a batch insert gets its own parentheses
+func TestInsertBatchSQL(t *testing.T) {
+	Convey("batch insert values", t, func() {
+		r := &sqlRecorder{}
+		tbl := Table(r, "test")
+
+		tbl.Insert(&[]x{{X: "a"}, {X: "b"}})
+		So(r.sqls[0], ShouldEqual, "insert into `test` (`name`,`age`,`ctime4`,`ctime`,`ctime2`,`ctime3`) values (?,?,?,?,?,?),(?,?,?,?,?,?)")
+
+		tbl.Insert(&[]*x{{X: "a"}, {X: "b"}, {X: "c"}})
+		So(r.sqls[1], ShouldEndWith, " values (?,?,?,?,?,?),(?,?,?,?,?,?),(?,?,?,?,?,?)")
+
+		tbl.Insert(&[]x{{X: "a"}})
+		So(r.sqls[2], ShouldEndWith, " values (?,?,?,?,?,?)")
+	})
+}
+
 func TestUpdate(t *testing.T) {
 	Convey("normal", t, func() {
 		// Insert test data first
@@ -1620,9 +1737,9 @@ func TestScanner(t *testing.T) {
 				Val:  unsafe.Pointer(&i),
 			}
 
+			// the timestamp is out of range
 			err := stringScanner.Scan(string("2019-03-01"))
-			So(err, ShouldBeNil)
-			So(i, ShouldEqual, int8(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC).Unix()))
+			So(err, ShouldNotBeNil)
 		})
 
 		Convey("string (DATE) to int16", func() {
@@ -1633,9 +1750,9 @@ func TestScanner(t *testing.T) {
 				Val:  unsafe.Pointer(&i),
 			}
 
+			// the timestamp is out of range
 			err := stringScanner.Scan(string("2019-03-01"))
-			So(err, ShouldBeNil)
-			So(i, ShouldEqual, int16(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC).Unix()))
+			So(err, ShouldNotBeNil)
 		})
 
 		Convey("string (DATE) to int32", func() {
@@ -1672,9 +1789,9 @@ func TestScanner(t *testing.T) {
 				Val:  unsafe.Pointer(&i),
 			}
 
+			// the timestamp is out of range
 			err := stringScanner.Scan(string("2019-03-01"))
-			So(err, ShouldBeNil)
-			So(i, ShouldEqual, uint8(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC).Unix()))
+			So(err, ShouldNotBeNil)
 		})
 
 		Convey("string (DATE) to uint16", func() {
@@ -1685,9 +1802,9 @@ func TestScanner(t *testing.T) {
 				Val:  unsafe.Pointer(&i),
 			}
 
+			// the timestamp is out of range
 			err := stringScanner.Scan(string("2019-03-01"))
-			So(err, ShouldBeNil)
-			So(i, ShouldEqual, uint16(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC).Unix()))
+			So(err, ShouldNotBeNil)
 		})
 
 		Convey("string (DATE) to uint32", func() {
@@ -1823,6 +1940,388 @@ func TestScanner(t *testing.T) {
 			So(err, ShouldNotBeNil)
 		})
 	})
+
+	Convey("overflow checked", t, func() {
+		Convey("uint64 above 2^63", func() {
+			var u uint64
+			uint64Scanner := scanner{
+				Type: reflect2.TypeOf(u),
+				Val:  unsafe.Pointer(&u),
+			}
+
+			So(uint64Scanner.Scan(uint64(math.MaxUint64)), ShouldBeNil)
+			So(u, ShouldEqual, uint64(math.MaxUint64))
+			So(uint64Scanner.Scan("18446744073709551615"), ShouldBeNil)
+			So(u, ShouldEqual, uint64(math.MaxUint64))
+			So(uint64Scanner.Scan([]byte("9223372036854775808")), ShouldBeNil)
+			So(u, ShouldEqual, uint64(1)<<63)
+			So(uint64Scanner.Scan(int64(-1)), ShouldNotBeNil)
+			So(uint64Scanner.Scan("-1"), ShouldNotBeNil)
+			So(uint64Scanner.Scan("18446744073709551616"), ShouldNotBeNil)
+
+			var i int64
+			int64Scanner := scanner{
+				Type: reflect2.TypeOf(i),
+				Val:  unsafe.Pointer(&i),
+			}
+			So(int64Scanner.Scan(uint64(math.MaxUint64)), ShouldNotBeNil)
+			So(int64Scanner.Scan(uint64(42)), ShouldBeNil)
+			So(i, ShouldEqual, 42)
+
+			var str string
+			stringScanner := scanner{
+				Type: reflect2.TypeOf(str),
+				Val:  unsafe.Pointer(&str),
+			}
+			So(stringScanner.Scan(uint64(math.MaxUint64)), ShouldBeNil)
+			So(str, ShouldEqual, "18446744073709551615")
+		})
+
+		Convey("small integers", func() {
+			var i8 int8
+			int8Scanner := scanner{
+				Type: reflect2.TypeOf(i8),
+				Val:  unsafe.Pointer(&i8),
+			}
+			So(int8Scanner.Scan(int64(-128)), ShouldBeNil)
+			So(i8, ShouldEqual, -128)
+			So(int8Scanner.Scan(int64(128)), ShouldNotBeNil)
+			So(int8Scanner.Scan("-129"), ShouldNotBeNil)
+
+			var u8 uint8
+			uint8Scanner := scanner{
+				Type: reflect2.TypeOf(u8),
+				Val:  unsafe.Pointer(&u8),
+			}
+			So(uint8Scanner.Scan(int64(255)), ShouldBeNil)
+			So(u8, ShouldEqual, 255)
+			err := uint8Scanner.Scan(int64(256))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "out of range")
+			So(uint8Scanner.Scan("256"), ShouldNotBeNil)
+			So(uint8Scanner.Scan(float64(-1)), ShouldNotBeNil)
+
+			var i32 int32
+			int32Scanner := scanner{
+				Type: reflect2.TypeOf(i32),
+				Val:  unsafe.Pointer(&i32),
+			}
+			So(int32Scanner.Scan(int64(math.MinInt32)), ShouldBeNil)
+			So(i32, ShouldEqual, math.MinInt32)
+			So(int32Scanner.Scan(int64(math.MaxInt32)+1), ShouldNotBeNil)
+			So(int32Scanner.Scan(float64(1e10)), ShouldNotBeNil)
+			So(int32Scanner.Scan(float64(-3.9)), ShouldBeNil)
+			So(i32, ShouldEqual, -3)
+			So(int32Scanner.Scan(true), ShouldBeNil)
+			So(i32, ShouldEqual, 1)
+		})
+
+		Convey("time strings", func() {
+			var i8 int8
+			int8Scanner := scanner{
+				Type: reflect2.TypeOf(i8),
+				Val:  unsafe.Pointer(&i8),
+			}
+			err := int8Scanner.Scan("2019-03-01 02:03:04")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "out of range")
+
+			var u8 uint8
+			uint8Scanner := scanner{
+				Type: reflect2.TypeOf(u8),
+				Val:  unsafe.Pointer(&u8),
+			}
+			So(uint8Scanner.Scan("2019-03-01 02:03:04"), ShouldNotBeNil)
+
+			var i32 int32
+			int32Scanner := scanner{
+				Type: reflect2.TypeOf(i32),
+				Val:  unsafe.Pointer(&i32),
+			}
+			So(int32Scanner.Scan("2100-01-01 00:00:00"), ShouldNotBeNil)
+			So(int32Scanner.Scan("2019-03-01 02:03:04"), ShouldBeNil)
+			So(i32, ShouldEqual, 1551405784)
+
+			var u32 uint32
+			uint32Scanner := scanner{
+				Type: reflect2.TypeOf(u32),
+				Val:  unsafe.Pointer(&u32),
+			}
+			So(uint32Scanner.Scan("2100-01-01 00:00:00"), ShouldBeNil)
+			So(u32, ShouldEqual, 4102444800)
+			So(uint32Scanner.Scan("1969-12-31 23:59:59"), ShouldNotBeNil)
+		})
+
+		Convey("floats", func() {
+			var f32 float32
+			float32Scanner := scanner{
+				Type: reflect2.TypeOf(f32),
+				Val:  unsafe.Pointer(&f32),
+			}
+			So(float32Scanner.Scan(float64(1.5)), ShouldBeNil)
+			So(f32, ShouldEqual, 1.5)
+			So(float32Scanner.Scan(uint64(1)<<40), ShouldBeNil)
+			So(f32, ShouldEqual, float32(1<<40))
+			So(float32Scanner.Scan(float64(math.MaxFloat64)), ShouldNotBeNil)
+			So(float32Scanner.Scan("1e39"), ShouldNotBeNil)
+
+			var i64 int64
+			int64Scanner := scanner{
+				Type: reflect2.TypeOf(i64),
+				Val:  unsafe.Pointer(&i64),
+			}
+			So(int64Scanner.Scan(float64(1e19)), ShouldNotBeNil)
+			So(int64Scanner.Scan(math.NaN()), ShouldNotBeNil)
+		})
+	})
+
+	Convey("sql.Scanner", t, func() {
+		Convey("string to sql.NullString", func() {
+			var ns sql.NullString
+			nsScanner := scanner{
+				Type: reflect2.TypeOf(ns),
+				Val:  unsafe.Pointer(&ns),
+			}
+
+			So(nsScanner.Scan("orca"), ShouldBeNil)
+			So(ns, ShouldResemble, sql.NullString{String: "orca", Valid: true})
+
+			So(nsScanner.Scan(nil), ShouldBeNil)
+			So(ns.Valid, ShouldBeFalse)
+		})
+
+		Convey("[]byte to custom type", func() {
+			var tags csvTags
+			tagsScanner := scanner{
+				Type: reflect2.TypeOf(tags),
+				Val:  unsafe.Pointer(&tags),
+			}
+
+			So(tagsScanner.Scan([]byte("a,b")), ShouldBeNil)
+			So(tags, ShouldResemble, csvTags{"a", "b"})
+
+			So(tagsScanner.Scan(int64(1)), ShouldNotBeNil)
+		})
+
+		Convey("to pointer of custom type", func() {
+			tags := &csvTags{"x"}
+			tagsScanner := scanner{
+				Type: reflect2.TypeOf(tags),
+				Val:  unsafe.Pointer(&tags),
+			}
+
+			So(tagsScanner.Scan("a,b"), ShouldBeNil)
+			So(*tags, ShouldResemble, csvTags{"a", "b"})
+
+			So(tagsScanner.Scan(nil), ShouldBeNil)
+			So(tags, ShouldBeNil)
+		})
+	})
+}
+
+func TestUint64RoundTrip(t *testing.T) {
+	type snowflake struct {
+		ID   uint64 `borm:"id"`
+		Name string `borm:"name"`
+	}
+
+	Convey("uint64 ids above 2^63", t, func() {
+		fdb, _ := sql.Open(FakeDriverName, "uint64_round_trip")
+		ResetFakeDB("uint64_round_trip")
+		fdb.Exec("create table `t_sf` (`id` bigint unsigned primary key, `name` varchar(64))")
+		tbl := Table(fdb, "t_sf")
+
+		id := uint64(math.MaxUint64 - 1)
+		_, err := tbl.Insert(&snowflake{ID: id, Name: "orca"})
+		So(err, ShouldBeNil)
+
+		var o snowflake
+		n, err := tbl.Select(&o, Where(Eq("name", "orca")))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(o.ID, ShouldEqual, id)
+	})
+}
+
+type csvTags []string
+
+func (c *csvTags) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*c = strings.Split(v, ",")
+	case []byte:
+		*c = strings.Split(string(v), ",")
+	case nil:
+		*c = nil
+	default:
+		return fmt.Errorf("cannot scan %T into csvTags", src)
+	}
+	return nil
+}
+
+func (c csvTags) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return strings.Join(c, ","), nil
+}
+
+type badValuer struct{}
+
+func (badValuer) Value() (driver.Value, error) {
+	return nil, errors.New("bad value")
+}
+
+func TestScannerValuer(t *testing.T) {
+	type item struct {
+		ID    int64          `borm:"id"`
+		Name  sql.NullString `borm:"name"`
+		Tags  csvTags        `borm:"tags"`
+		PTags *csvTags       `borm:"ptags"`
+	}
+
+	Convey("round trip", t, func() {
+		fdb, _ := sql.Open(FakeDriverName, "scanner_valuer")
+		ResetFakeDB("scanner_valuer")
+		fdb.Exec("create table `t_item` (`id` bigint primary key, `name` varchar(64), `tags` varchar(64), `ptags` varchar(64))")
+		tbl := Table(fdb, "t_item")
+
+		_, err := tbl.Insert(&item{ID: 1, Name: sql.NullString{String: "orca", Valid: true}, Tags: csvTags{"a", "b"}, PTags: &csvTags{"c"}})
+		So(err, ShouldBeNil)
+		_, err = tbl.Insert(&item{ID: 2})
+		So(err, ShouldBeNil)
+
+		var o []item
+		_, err = tbl.Select(&o, OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(len(o), ShouldEqual, 2)
+		So(o[0].Name, ShouldResemble, sql.NullString{String: "orca", Valid: true})
+		So(o[0].Tags, ShouldResemble, csvTags{"a", "b"})
+		So(*o[0].PTags, ShouldResemble, csvTags{"c"})
+		So(o[1].Name.Valid, ShouldBeFalse)
+		So(o[1].Tags, ShouldBeNil)
+		So(o[1].PTags, ShouldBeNil)
+
+		_, err = tbl.Update(&item{Tags: csvTags{"d"}}, Fields("tags"), Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		var tags csvTags
+		_, err = tbl.Select(&tags, Fields("tags"), Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		So(tags, ShouldResemble, csvTags{"d"})
+	})
+
+	Convey("valuer error", t, func() {
+		type bad struct {
+			B badValuer `borm:"b"`
+		}
+		fdb, _ := sql.Open(FakeDriverName, "scanner_valuer")
+		_, err := Table(fdb, "t_bad").Insert(&bad{})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "bad value")
+	})
+}
+
+type countingCodec struct {
+	marshal, unmarshal int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshal++
+	return json.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshal++
+	return json.Unmarshal(data, v)
+}
+
+func TestJSONField(t *testing.T) {
+	type attrs struct {
+		Color string `json:"color"`
+		Size  int    `json:"size"`
+	}
+	type item struct {
+		ID    int64             `borm:"id"`
+		Attrs attrs             `borm:"attrs,json"`
+		Meta  map[string]string `borm:"meta,json"`
+		Tags  []string          `borm:"tags,json"`
+		Extra *attrs            `borm:"extra,json"`
+	}
+
+	Convey("round trip", t, func() {
+		fdb := openFakeDB(t, "json_field")
+		fdb.Exec("create table `t_item` (`id` bigint primary key, `attrs` json, `meta` json, `tags` json, `extra` json)")
+		tbl := Table(fdb, "t_item")
+
+		_, err := tbl.Insert(&item{ID: 1, Attrs: attrs{"red", 1}, Meta: map[string]string{"k": "v"}, Tags: []string{"a"}, Extra: &attrs{Size: 2}})
+		So(err, ShouldBeNil)
+		_, err = tbl.Insert(&item{ID: 2})
+		So(err, ShouldBeNil)
+
+		var raw []string
+		_, err = tbl.Select(&raw, Fields("coalesce(tags, 'NULL')"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(raw, ShouldResemble, []string{`["a"]`, "NULL"})
+
+		var o []item
+		_, err = tbl.Select(&o, OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(len(o), ShouldEqual, 2)
+		So(o[0].Attrs, ShouldResemble, attrs{"red", 1})
+		So(o[0].Meta, ShouldResemble, map[string]string{"k": "v"})
+		So(o[0].Tags, ShouldResemble, []string{"a"})
+		So(*o[0].Extra, ShouldResemble, attrs{Size: 2})
+		So(o[1].Meta, ShouldBeNil)
+		So(o[1].Tags, ShouldBeNil)
+		So(o[1].Extra, ShouldBeNil)
+
+		_, err = tbl.Update(&item{Meta: map[string]string{"x": "y"}}, Fields("meta"), Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		_, err = tbl.Update(V{"tags": JSON([]string{"b", "c"})}, Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		_, err = tbl.Insert(&item{ID: 2}, OnDuplicateKeyUpdate(V{"extra": JSON(attrs{Color: "blue"})}))
+		So(err, ShouldBeNil)
+
+		var o2 item
+		_, err = tbl.Select(&o2, Fields("meta", "tags", "extra"), Where(Eq("id", 2)))
+		So(err, ShouldBeNil)
+		So(o2.Meta, ShouldResemble, map[string]string{"x": "y"})
+		So(o2.Tags, ShouldResemble, []string{"b", "c"})
+		So(*o2.Extra, ShouldResemble, attrs{Color: "blue"})
+	})
+
+	Convey("empty and invalid", t, func() {
+		var m map[string]int
+		jsonScanner := scanner{
+			Type: reflect2.TypeOf(m),
+			Val:  unsafe.Pointer(&m),
+			JSON: true,
+		}
+
+		So(jsonScanner.Scan([]byte(`{"a":1}`)), ShouldBeNil)
+		So(m, ShouldResemble, map[string]int{"a": 1})
+		So(jsonScanner.Scan(""), ShouldBeNil)
+		So(m, ShouldBeNil)
+		So(jsonScanner.Scan("{"), ShouldNotBeNil)
+	})
+
+	Convey("custom codec", t, func() {
+		c := &countingCodec{}
+		SetJSONCodec(c)
+		defer SetJSONCodec(nil)
+
+		fdb := openFakeDB(t, "json_codec")
+		fdb.Exec("create table `t_item` (`id` bigint primary key, `attrs` json, `meta` json, `tags` json, `extra` json)")
+		tbl := Table(fdb, "t_item")
+		_, err := tbl.Insert(&item{ID: 1, Attrs: attrs{"red", 1}, Meta: map[string]string{"k": "v"}})
+		So(err, ShouldBeNil)
+		So(c.marshal, ShouldEqual, 2)
+
+		var o item
+		_, err = tbl.Select(&o, Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(c.unmarshal, ShouldEqual, 2)
+	})
 }
 
 func TestMatchString(t *testing.T) {
@@ -2084,7 +2583,7 @@ func TestMisc(t *testing.T) {
 			w.BuildSQL(&sb)
 			w.BuildArgs(&stmtArgs)
 
-			So(sb.String(), ShouldEqual, " where 1=1")
+			So(sb.String(), ShouldEqual, " where 1=0")
 			So(len(stmtArgs), ShouldEqual, 0)
 		})
 		Convey("Where In empty slice slice", func() {
@@ -2094,8 +2593,46 @@ func TestMisc(t *testing.T) {
 			w.BuildSQL(&sb)
 			w.BuildArgs(&stmtArgs)
 
+			So(sb.String(), ShouldEqual, " where 1=0")
+			So(len(stmtArgs), ShouldEqual, 0)
+		})
+		Convey("Where In empty slice match all", func() {
+			w := Where(In("id", []int64{}, EmptyInMatchAll))
+			var sb strings.Builder
+			var stmtArgs []interface{}
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
 			So(sb.String(), ShouldEqual, " where 1=1")
 			So(len(stmtArgs), ShouldEqual, 0)
+
+			w = Where(In("id", []int64{1, 2}, EmptyInMatchAll))
+			sb.Reset()
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
+			So(sb.String(), ShouldEqual, " where `id` in (?,?)")
+			So(stmtArgs, ShouldResemble, []interface{}{int64(1), int64(2)})
+		})
+		Convey("Delete In empty slice", func() {
+			fdb := openFakeDB(t, "fake_in_empty")
+			tbl := Table(fdb, "t_usr")
+			_, err := tbl.Insert(&[]fakeUser{{Name: "Alice"}, {Name: "Bob"}})
+			So(err, ShouldBeNil)
+
+			var ids []int64
+			n, err := tbl.Delete(Where(In("id", ids)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+
+			var names []string
+			n, err = tbl.Select(&names, Fields("name"), Where(In("id", ids)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+
+			n, err = tbl.Select(&names, Fields("name"), Where(In("id", ids, EmptyInMatchAll)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
 		})
 		Convey("Where In 1 slice", func() {
 			w := Where(In("id", []interface{}{1}))
@@ -2118,6 +2655,71 @@ func TestMisc(t *testing.T) {
 			So(sb.String(), ShouldEqual, " where `id` in (?,?)")
 			So(len(stmtArgs), ShouldEqual, 2)
 		})
+		Convey("Where In typed slice", func() {
+			ids := []int64{1, 2}
+			w := Where(In("id", ids))
+			ids[0] = 3
+
+			var stmtArgs []interface{}
+			w.BuildArgs(&stmtArgs)
+			// elements are copied, not pointers into the slice
+			So(stmtArgs, ShouldResemble, []interface{}{int64(1), int64(2)})
+
+			one := 1
+			w = Where(In("id", []*int{&one}))
+			stmtArgs = nil
+			w.BuildArgs(&stmtArgs)
+			So(stmtArgs, ShouldResemble, []interface{}{&one})
+		})
+		Convey("Where NotIn", func() {
+			w := Where(NotIn("id", []int64{}))
+			var sb strings.Builder
+			var stmtArgs []interface{}
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
+			So(sb.String(), ShouldEqual, " where 1=1")
+			So(len(stmtArgs), ShouldEqual, 0)
+
+			w = Where(NotIn("id", []int64{1, 2}))
+			sb.Reset()
+			stmtArgs = nil
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
+			So(sb.String(), ShouldEqual, " where `id` not in (?,?)")
+			So(stmtArgs, ShouldResemble, []interface{}{int64(1), int64(2)})
+		})
+		Convey("Where negation and null", func() {
+			w := Where(NotLike("name", "x%"), NotBetween("age", 1, 2), IsNull("email"), IsNotNull("ctime"))
+			var sb strings.Builder
+			var stmtArgs []interface{}
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
+			So(sb.String(), ShouldEqual, " where `name` not like ? and `age` not between ? and ? and `email` is null and `ctime` is not null")
+			So(stmtArgs, ShouldResemble, []interface{}{"x%", 1, 2})
+		})
+		Convey("Where Not", func() {
+			w := Where(Eq("id", 1), Not(Or(Eq("x", 1), And(Eq("y", 2), Eq("z", 3)))))
+			var sb strings.Builder
+			var stmtArgs []interface{}
+			w.BuildSQL(&sb)
+			w.BuildArgs(&stmtArgs)
+
+			So(sb.String(), ShouldEqual, " where `id`=? and not (`x`=? or (`y`=? and `z`=?))")
+			So(stmtArgs, ShouldResemble, []interface{}{1, 1, 2, 3})
+
+			w = Where(Or(Not(Eq("x", 1)), Not(And(Eq("y", 2), Eq("z", 3)))))
+			sb.Reset()
+			w.BuildSQL(&sb)
+			So(sb.String(), ShouldEqual, " where not (`x`=?) or not (`y`=? and `z`=?)")
+
+			w = Where(Not(And()))
+			sb.Reset()
+			w.BuildSQL(&sb)
+			So(sb.String(), ShouldEqual, " where 1=0")
+		})
 		Convey("Where - 1st empty And", func() {
 			// And empty
 			w := Where(And())
@@ -3597,7 +4199,7 @@ func TestConcurrentFieldMapCache(t *testing.T) {
 
 		// Concurrently call getStructFieldMap
 		done := make(chan bool, 10)
-		results := make([]map[string]reflect2.StructField, 10)
+		results := make([]map[string]*structColumn, 10)
 
 		for i := 0; i < 10; i++ {
 			go func(index int) {
@@ -3959,6 +4561,1459 @@ func TestComplexQueries(t *testing.T) {
 	})
 }
 
+func TestSubQuery(t *testing.T) {
+	Convey("sub-queries", t, func() {
+		c, tbl := captureTable(t, "fake_subquery", "t_usr", "create table `t_tag` (`uid` bigint not null, `tag` varchar(64) not null default '')")
+		_, err := tbl.Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}, {Name: "Carol", Age: 30}})
+		So(err, ShouldBeNil)
+		_, err = Table(c, "t_tag").Insert(&[]V{{"uid": 1, "tag": "go"}, {"uid": 3, "tag": "go"}, {"uid": 3, "tag": "c"}})
+		So(err, ShouldBeNil)
+
+		Convey("in", func() {
+			var names []string
+			n, err := tbl.Select(&names, Fields("name"),
+				Where(In("id", SubQuery("t_tag", Fields("uid"), Where(Eq("tag", "go")))), Gt("age", 10)),
+				OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(names, ShouldResemble, []string{"Alice", "Carol"})
+
+			So(c.Last().SQL, ShouldEqual, "select `name` from `t_usr` where `id` in (select `uid` from `t_tag` where `tag`=?) and `age`>? order by `id`")
+			So(c.Last().Args, ShouldResemble, []interface{}{"go", 10})
+		})
+
+		Convey("exists", func() {
+			var cnt int64
+			_, err := tbl.Select(&cnt, Fields("count(1)"), Where(Exists(SubQuery("t_tag", Where(Eq("tag", "c"))))))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 3)
+
+			_, err = tbl.Select(&cnt, Fields("count(1)"), Where(NotExists(SubQuery("t_tag", Where(Eq("tag", "c"))))))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 0)
+
+			So(c.Last().SQL, ShouldEqual, "select count(1) from `t_usr` where not exists (select * from `t_tag` where `tag`=?)")
+		})
+
+		Convey("comparison", func() {
+			var o fakeUser
+			n, err := tbl.Select(&o, Where(Eq("age", SubQuery("t_usr", Fields("max(age)")))))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(o.Name, ShouldEqual, "Carol")
+
+			var names []string
+			_, err = tbl.Select(&names, Fields("name"), Where(Lt("age", SubQuery("t_usr", Fields("age"), Where(Eq("name", "Bob"))))))
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"Alice"})
+		})
+
+		Convey("scalar field", func() {
+			type userTags struct {
+				Name string `borm:"name"`
+				Tags int64  `borm:"tags"`
+			}
+			var o userTags
+			n, err := tbl.Select(&o, Fields("name").Scalar("tags", SubQuery("t_tag", Fields("count(1)"), Where(Eq("uid", 3)))),
+				Where(Eq("name", "Carol")))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(o.Tags, ShouldEqual, 2)
+
+			So(c.Last().SQL, ShouldEqual, "select `name`,(select count(1) from `t_tag` where `uid`=?) as `tags` from `t_usr` where `name`=?")
+			So(c.Last().Args, ShouldResemble, []interface{}{3, "Carol"})
+
+			var tags []int64
+			_, err = tbl.Select(&tags, Fields().Scalar("tags", SubQuery("t_tag", Fields("count(1)"), Where(Eq("uid", 1)))), Limit(1))
+			So(err, ShouldBeNil)
+			So(tags, ShouldResemble, []int64{1})
+		})
+
+		Convey("negation", func() {
+			_, err := tbl.Update(V{"ctime": U("null")}, Where(Eq("name", "Bob")))
+			So(err, ShouldBeNil)
+
+			var names []string
+			_, err = tbl.Select(&names, Fields("name"), Where(NotIn("id", SubQuery("t_tag", Fields("uid")))))
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"Bob"})
+
+			names = nil
+			_, err = tbl.Select(&names, Fields("name"), Where(Not(Or(Like("name", "A%"), NotBetween("age", 19, 25)))))
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"Bob"})
+
+			names = nil
+			_, err = tbl.Select(&names, Fields("name"), Where(IsNotNull("ctime"), NotLike("name", "C%")), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"Alice"})
+
+			var cnt int64
+			_, err = tbl.Select(&cnt, Fields("count(1)"), Where(IsNull("ctime"), NotIn("id", []int64{})))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 1)
+		})
+
+		Convey("reuse cache key", func() {
+			a := buildShapeKey("k", "Select", []BormItem{Where(In("id", SubQuery("t_tag", Fields("uid"))))})
+			b := buildShapeKey("k", "Select", []BormItem{Where(In("id", SubQuery("t_tag", Fields("uid"), Where(Eq("tag", "go")))))})
+			So(a, ShouldNotEqual, b)
+		})
+	})
+}
+
+func TestInTuple(t *testing.T) {
+	Convey("InTuple", t, func() {
+		type key struct {
+			Name string `borm:"name"`
+			Age  int64  `borm:"age"`
+		}
+
+		Convey("row values", func() {
+			for _, rows := range []interface{}{
+				[]key{{"Alice", 18}, {"Carol", 30}},
+				&[]*key{{"Alice", 18}, {"Carol", 30}},
+				[][]interface{}{{"Alice", 18}, {"Carol", 30}},
+				[]V{{"name": "Alice", "age": 18}, {"age": 30, "name": "Carol"}},
+			} {
+				w := Where(InTuple([]string{"name", "age"}, rows))
+				var sb strings.Builder
+				var stmtArgs []interface{}
+				w.BuildSQL(&sb)
+				w.BuildArgs(&stmtArgs)
+
+				So(sb.String(), ShouldEqual, " where (`name`,`age`) in ((?,?),(?,?))")
+				So(fmt.Sprint(stmtArgs), ShouldEqual, "[Alice 18 Carol 30]")
+			}
+		})
+
+		Convey("empty and invalid rows", func() {
+			var sb strings.Builder
+			Where(InTuple([]string{"name", "age"}, []key{})).BuildSQL(&sb)
+			So(sb.String(), ShouldEqual, " where 1=0")
+
+			c := NewBormCapture(nil)
+			tbl := Table(c, "t_usr")
+			var names []string
+			for _, cond := range []*ormCond{
+				InTuple([]string{"name"}, key{}),
+				InTuple([]string{"id"}, []key{{}}),
+				InTuple([]string{"name", "age"}, [][]interface{}{{"Alice"}}),
+				InTuple([]string{"name", "age"}, []V{{"name": "Alice"}}),
+			} {
+				_, err := tbl.Select(&names, Fields("name"), Where(Gt("id", 0), Or(cond)))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "InTuple: ")
+			}
+
+			_, err := tbl.Select(&names, Fields("name"), Where(In("id", SubQuery("t_usr", Fields("id"), Where(InTuple([]string{"id"}, []key{{}}))))))
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, 0)
+		})
+
+		Convey("untagged fields", func() {
+			type member struct {
+				UserName string
+				Age      int64 `borm:"age"`
+			}
+			c := NewBormCapture(nil)
+			rows := []member{{"Alice", 18}}
+			var names []string
+
+			_, err := Table(c, "t_usr").Select(&names, Fields("name"), Where(InTuple([]string{"UserName", "age"}, rows)))
+			So(err, ShouldNotBeNil)
+
+			Table(c, "t_usr").UseNameWhenTagEmpty().Select(&names, Fields("name"), Where(InTuple([]string{"UserName", "age"}, rows)))
+			So(c.Last().SQL, ShouldEqual, "select `name` from `t_usr` where (`UserName`,`age`) in ((?,?))")
+			So(c.Last().Args, ShouldResemble, []interface{}{"Alice", int64(18)})
+		})
+
+		Convey("query", func() {
+			c, _ := captureTable(t, "fake_in_tuple", "t_usr")
+			_, err := Table(c, "t_usr").Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}, {Name: "Carol", Age: 30}})
+			So(err, ShouldBeNil)
+
+			keys := []key{{"Alice", 18}, {"Bob", 21}, {"Carol", 30}}
+			var names []string
+			n, err := Table(c, "t_usr").Select(&names, Fields("name"), Where(Gt("id", 0), InTuple([]string{"name", "age"}, keys)), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(names, ShouldResemble, []string{"Alice", "Carol"})
+
+			So(c.Last().SQL, ShouldEqual, "select `name` from `t_usr` where `id`>? and (`name`,`age`) in ((?,?),(?,?),(?,?)) order by `id`")
+
+			noRowValues := &Dialect{Name: "legacy"}
+			names = nil
+			n, err = Table(c, "t_usr").Dialect(noRowValues).Select(&names, Fields("name"), Where(Gt("id", 0), InTuple([]string{"name", "age"}, keys)), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(names, ShouldResemble, []string{"Alice", "Carol"})
+
+			So(c.Last().SQL, ShouldEqual, "select `name` from `t_usr` where `id`>? and ((`name`=? and `age`=?) or (`name`=? and `age`=?) or (`name`=? and `age`=?)) order by `id`")
+			So(c.Last().Args, ShouldResemble, []interface{}{0, "Alice", int64(18), "Bob", int64(21), "Carol", int64(30)})
+
+			n, err = Table(c, "t_usr").Dialect(noRowValues).Delete(Where(Not(InTuple([]string{"name", "age"}, keys[:1]))))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+
+			So(c.Last().SQL, ShouldEqual, "delete from `t_usr` where not (`name`=? and `age`=?)")
+		})
+	})
+}
+
+func TestJoin(t *testing.T) {
+	Convey("join", t, func() {
+		c, _ := captureTable(t, "fake_join", "t_usr", "create table `t_tag` (`uid` bigint not null, `tag` varchar(64) not null default '')")
+		_, err := Table(c, "t_usr").Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}, {Name: "Carol", Age: 30}})
+		So(err, ShouldBeNil)
+		_, err = Table(c, "t_tag").Insert(&[]V{{"uid": 1, "tag": "go"}, {"uid": 3, "tag": "go"}, {"uid": 3, "tag": "c"}})
+		So(err, ShouldBeNil)
+
+		type userTag struct {
+			ID   int64  `borm:"id"`
+			Name string `borm:"name"`
+			Tag  string `borm:"g.tag"`
+		}
+
+		Convey("inner join", func() {
+			var o []userTag
+			n, err := Table(c, "t_usr").AutoQualify().Select(&o,
+				Where(Gt("t_usr.age", 10)),
+				InnerJoin("t_tag", "g", Cond("`g`.`uid`=`t_usr`.`id`"), Eq("g.tag", "go")),
+				OrderBy("t_usr.id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(o, ShouldResemble, []userTag{{1, "Alice", "go"}, {3, "Carol", "go"}})
+
+			So(c.Last().SQL, ShouldEqual, "select `t_usr`.`id`,`t_usr`.`name`,g.tag from `t_usr` inner join `t_tag` as `g` on `g`.`uid`=`t_usr`.`id` and g.tag=? where t_usr.age>? order by t_usr.id")
+			So(c.Last().Args, ShouldResemble, []interface{}{"go", 10})
+		})
+
+		Convey("left join", func() {
+			var o []userTag
+			n, err := Table(c, "t_usr").AutoQualify().Select(&o, Fields("id", "name", "g.tag"),
+				LeftJoin("t_tag", "g", "`g`.`uid`=`t_usr`.`id` and `g`.`tag`=?", "c"),
+				OrderBy("t_usr.id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+			So(o, ShouldResemble, []userTag{{1, "Alice", ""}, {2, "Bob", ""}, {3, "Carol", "c"}})
+
+			So(c.Last().SQL, ShouldEqual, "select `t_usr`.`id`,`t_usr`.`name`,g.tag from `t_usr` left join `t_tag` as `g` on `g`.`uid`=`t_usr`.`id` and `g`.`tag`=? order by t_usr.id")
+		})
+
+		Convey("without AutoQualify", func() {
+			type user struct {
+				ID   int64  `borm:"id"`
+				Name string `borm:"name"`
+			}
+			var o []user
+			n, err := Table(c, "t_usr").Select(&o, Where(Gt("age", 19)), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+
+			o = nil
+			n, err = Table(c, "t_usr").AutoQualify().Select(&o, Where(Gt("age", 19)), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(o[0], ShouldResemble, user{2, "Bob"})
+
+			So(c.Last().SQL, ShouldEqual, "select `t_usr`.`id`,`t_usr`.`name` from `t_usr` where `age`>? order by `id`")
+		})
+
+		Convey("nested structs", func() {
+			type tag struct {
+				UID int64  `borm:"uid"`
+				Tag string `borm:"tag"`
+			}
+			type userWithTag struct {
+				User fakeUser `borm:"t_usr.*"`
+				Tag  *tag     `borm:"g.*"`
+				Cnt  int64    `borm:"-"`
+			}
+
+			var o []userWithTag
+			n, err := Table(c, "t_usr").Select(&o,
+				LeftJoin("t_tag", "g", Cond("`g`.`uid`=`t_usr`.`id`"), Eq("g.tag", "go")),
+				OrderBy("t_usr.id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+
+			So(c.Last().SQL, ShouldEqual, "select `t_usr`.`id`,`t_usr`.`name`,`t_usr`.`age`,`t_usr`.`ctime`,`g`.`uid`,`g`.`tag` from `t_usr` left join `t_tag` as `g` on `g`.`uid`=`t_usr`.`id` and g.tag=? order by t_usr.id")
+
+			So(o[0].User.Name, ShouldEqual, "Alice")
+			So(o[0].Tag, ShouldResemble, &tag{1, "go"})
+			So(o[1].User.Name, ShouldEqual, "Bob")
+			So(o[1].User.Age, ShouldEqual, 20)
+			So(o[1].Tag, ShouldBeNil)
+			So(o[2].User.ID, ShouldEqual, 3)
+			So(o[2].Tag, ShouldResemble, &tag{3, "go"})
+			So(o[0].Tag, ShouldNotPointTo, o[2].Tag)
+
+			var one userWithTag
+			n, err = Table(c, "t_usr").Select(&one,
+				LeftJoin("t_tag", "g", Cond("`g`.`uid`=`t_usr`.`id`")),
+				Where(Eq("t_usr.name", "Bob")))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(one.User.ID, ShouldEqual, 2)
+			So(one.Tag, ShouldBeNil)
+
+			var bad []struct {
+				Tag string `borm:"g.*"`
+			}
+			_, err = Table(c, "t_usr").Select(&bad, LeftJoin("t_tag", "g", Cond("`g`.`uid`=`t_usr`.`id`")))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("right join", func() {
+			var sb strings.Builder
+			var stmtArgs []interface{}
+			j := RightJoin("t_tag", "", Or(Eq("uid", 1), And(Eq("tag", "go"), Neq("uid", 2))))
+			j.BuildSQL(&sb)
+			j.BuildArgs(&stmtArgs)
+			So(sb.String(), ShouldEqual, " right join `t_tag` on `uid`=? or (`tag`=? and `uid`<>?)")
+			So(stmtArgs, ShouldResemble, []interface{}{1, "go", 2})
+
+			sb.Reset()
+			InnerJoin("t_tag", "g").BuildSQL(&sb)
+			So(sb.String(), ShouldEqual, " inner join `t_tag` as `g`")
+		})
+	})
+}
+
+func TestUnion(t *testing.T) {
+	Convey("union", t, func() {
+		c, _ := captureTable(t, "fake_union", "t_usr", "create table `t_post` (`id` bigint not null auto_increment, `uid` bigint, `title` varchar(64), `ctime` bigint, primary key (`id`))", "create table `t_comment` (`id` bigint not null auto_increment, `uid` bigint, `content` varchar(64), `ctime` bigint, primary key (`id`))")
+		_, err := Table(c, "t_post").Insert(&[]V{{"uid": 1, "title": "hello", "ctime": 10}, {"uid": 2, "title": "world", "ctime": 30}})
+		So(err, ShouldBeNil)
+		_, err = Table(c, "t_comment").Insert(&[]V{{"uid": 1, "content": "nice", "ctime": 20}, {"uid": 1, "content": "hello", "ctime": 40}})
+		So(err, ShouldBeNil)
+
+		type activity struct {
+			UID   int64  `borm:"uid"`
+			Text  string `borm:"text"`
+			Ctime int64  `borm:"ctime"`
+		}
+
+		Convey("union all", func() {
+			var o []activity
+			n, err := Table(c, "feed").Select(&o,
+				UnionAll(
+					SubQuery("t_post", Fields("uid", "title as text", "ctime"), Where(Eq("uid", 1))),
+					SubQuery("t_comment", Fields("uid", "content as text", "ctime"), Where(Eq("uid", 1)))),
+				Where(Gt("ctime", 5)),
+				OrderBy("ctime desc"), Limit(2))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(o, ShouldResemble, []activity{{1, "hello", 40}, {1, "nice", 20}})
+
+			So(c.Last().SQL, ShouldEqual, "select `uid`,`text`,`ctime` from (select `uid`,title as text,`ctime` from `t_post` where `uid`=? union all select `uid`,content as text,`ctime` from `t_comment` where `uid`=?) as `feed` where `ctime`>? order by ctime desc limit ?")
+			So(c.Last().Args, ShouldResemble, []interface{}{1, 1, 5, 2})
+		})
+
+		Convey("union", func() {
+			var texts []string
+			n, err := Table(c, "feed").Select(&texts, Fields("text"),
+				Union(
+					SubQuery("t_post", Fields("title as text"), OrderBy("ctime"), Limit(1)),
+					SubQuery("t_comment", Fields("content as text"))),
+				OrderBy("text"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(texts, ShouldResemble, []string{"hello", "nice"})
+
+			So(c.Last().SQL, ShouldEqual, "select `text` from ((select title as text from `t_post` order by `ctime` limit ?) union select content as text from `t_comment`) as `feed` order by `text`")
+
+			var m []map[string]interface{}
+			n, err = Table(c, "feed").Select(&m, Fields("text"),
+				Union(SubQuery("t_post", Fields("title as text")), SubQuery("t_comment", Fields("content as text"))),
+				Where(Like("text", "h%")))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(m[0]["text"], ShouldEqual, "hello")
+		})
+	})
+}
+
+func TestWith(t *testing.T) {
+	Convey("with", t, func() {
+		c, cats := captureTable(t, "fake_with", "t_cat", "create table `t_cat` (`id` bigint not null, `pid` bigint not null default 0, `name` varchar(64), primary key (`id`))")
+		_, err := cats.Insert(&[]V{
+			{"id": 1, "pid": 0, "name": "root"},
+			{"id": 2, "pid": 1, "name": "a"},
+			{"id": 3, "pid": 1, "name": "b"},
+			{"id": 4, "pid": 2, "name": "a1"},
+			{"id": 5, "pid": 9, "name": "orphan"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("plain", func() {
+			var names []string
+			n, err := Table(c, "top").Select(&names, Fields("name"),
+				With("top", SubQuery("t_cat", Fields("id", "name"), Where(Eq("pid", 1)))),
+				Where(Gt("id", 2)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(names, ShouldResemble, []string{"b"})
+
+			So(c.Last().SQL, ShouldEqual, "with `top` as (select `id`,`name` from `t_cat` where `pid`=?) select `name` from `top` where `id`>?")
+			So(c.Last().Args, ShouldResemble, []interface{}{1, 2})
+		})
+
+		Convey("recursive", func() {
+			type cat struct {
+				ID   int64  `borm:"id"`
+				Name string `borm:"name"`
+			}
+			var o []cat
+			n, err := Table(c, "tree").Select(&o,
+				WithRecursive("tree(id,name)", UnionAll(
+					SubQuery("t_cat", Fields("id", "name"), Where(Eq("id", 2))),
+					SubQuery("t_cat", Fields("t_cat.id", "t_cat.name"),
+						InnerJoin("tree", "", Cond("`tree`.`id`=`t_cat`.`pid`"))))),
+				OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(o, ShouldResemble, []cat{{2, "a"}, {4, "a1"}})
+
+			So(c.Last().SQL, ShouldEqual, "with recursive tree(id,name) as (select `id`,`name` from `t_cat` where `id`=? union all select t_cat.id,t_cat.name from `t_cat` inner join `tree` on `tree`.`id`=`t_cat`.`pid`) select `id`,`name` from `tree` order by `id`")
+		})
+
+		Convey("column cache", func() {
+			type cat struct {
+				ID   int64  `borm:"id"`
+				Name string `borm:"name"`
+			}
+			top := Table(c, "top")
+			st := reflect2.TypeOf(cat{}).(reflect2.StructType)
+			sf := top.structFields(st)
+
+			// the table with the CTE maps columns with the cache of top
+			wt, _ := top.withCTE([]BormItem{With("top", SubQuery("t_cat", Fields("id", "name")))})
+			So(wt.structFields(st), ShouldPointTo, sf)
+
+			var o []cat
+			_, err := top.Select(&o, With("top", SubQuery("t_cat", Fields("id", "name"))), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(len(o), ShouldEqual, 5)
+			So(top.structFields(st), ShouldPointTo, sf)
+		})
+
+		Convey("update and delete", func() {
+			roots := With("roots", SubQuery("t_cat", Fields("id"), Where(Eq("pid", 0))))
+			n, err := cats.Update(V{"name": "top"}, roots, Where(In("pid", SubQuery("roots", Fields("id")))))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+
+			n, err = cats.Delete(roots, Where(NotIn("pid", SubQuery("t_cat", Fields("id"))), NotIn("id", SubQuery("roots", Fields("id")))))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+
+			So(c.Last().SQL, ShouldEqual, "with `roots` as (select `id` from `t_cat` where `pid`=?) delete from `t_cat` where `pid` not in (select `id` from `t_cat`) and `id` not in (select `id` from `roots`)")
+
+			_, err = cats.Delete(roots)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("insert", func() {
+			roots := With("roots", SubQuery("t_cat", Fields("id"), Where(Eq("pid", 0))))
+			before := len(c.Stmts())
+			_, err := cats.Insert(V{"id": 6, "name": "c"}, roots)
+			So(err, ShouldNotBeNil)
+			_, err = cats.InsertIgnore(&[]V{{"id": 6, "name": "c"}}, roots)
+			So(err, ShouldNotBeNil)
+			_, err = cats.ReplaceInto(V{"id": 6, "name": "c"}, roots)
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, before)
+		})
+	})
+}
+
+func TestLocking(t *testing.T) {
+	Convey("locking clauses", t, func() {
+		c, tbl := captureTable(t, "fake_locking", "t_usr")
+		_, err := tbl.Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}})
+		So(err, ShouldBeNil)
+
+		Convey("mysql", func() {
+			tx, err := c.DB.(*sql.DB).BeginTx(context.TODO(), nil)
+			So(err, ShouldBeNil)
+			defer tx.Rollback()
+
+			var o []fakeUser
+			n, err := Table(NewBormCapture(tx), "t_usr").Select(&o, ForUpdate().SkipLocked(), Where(Gt("age", 0)), OrderBy("id"), Limit(1))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+
+			var ids []int64
+			_, err = tbl.Select(&ids, Fields("id"), ForUpdate(), Where(Gt("age", 0)), Limit(1))
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` where `age`>? limit ? for update")
+
+			_, err = tbl.Select(&ids, Fields("id"), ForShare().NoWait())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` for share nowait")
+
+			_, err = tbl.Select(&ids, Fields("id"), LockInShareMode())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` lock in share mode")
+
+			_, err = tbl.Select(&ids, Fields("id"), LockInShareMode().SkipLocked())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` for share skip locked")
+
+			var m []map[string]interface{}
+			_, err = tbl.Select(&m, Fields("id"), ForUpdate().NoWait(), Limit(1))
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` limit ? for update nowait")
+		})
+
+		Convey("other dialects", func() {
+			var ids []int64
+			_, err := Table(c, "t_usr").Dialect(MySQL57).Select(&ids, Fields("id"), ForShare())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_usr` lock in share mode")
+
+			n := len(c.Stmts())
+			_, err = Table(c, "t_usr").Dialect(MySQL57).Select(&ids, Fields("id"), ForUpdate().SkipLocked())
+			So(err, ShouldNotBeNil)
+			_, err = Table(c, "t_usr").Dialect(MySQL57).Select(&ids, Fields("id"), ForShare().NoWait())
+			So(err, ShouldNotBeNil)
+			_, err = Table(c, "t_usr").Dialect(SQLite).Select(&ids, Fields("id"), ForUpdate())
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, n)
+		})
+
+		Convey("update and delete", func() {
+			n := len(c.Stmts())
+			_, err := tbl.Update(V{"age": 1}, Where(Eq("id", 1)), ForUpdate())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "ForUpdate, ForShare and LockInShareMode can't be used with Update")
+			_, err = tbl.Update(&fakeUser{Name: "Alice"}, Fields("name"), Where(Eq("id", 1)), LockInShareMode())
+			So(err, ShouldNotBeNil)
+			_, err = tbl.Delete(Where(Eq("id", 1)), ForShare())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "ForUpdate, ForShare and LockInShareMode can't be used with Delete")
+			So(len(c.Stmts()), ShouldEqual, n)
+		})
+	})
+}
+
+func TestPK(t *testing.T) {
+	type pkUser struct {
+		ID   int64  `borm:"id,pk"`
+		Name string `borm:"name"`
+		Age  int64  `borm:"age"`
+	}
+
+	Convey("primary key helpers", t, func() {
+		c, tbl := captureTable(t, "fake_pk", "t_usr")
+		_, err := tbl.Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}})
+		So(err, ShouldBeNil)
+
+		Convey("get, update and delete", func() {
+			o := pkUser{ID: 2}
+			n, err := tbl.GetByPK(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(o.Name, ShouldEqual, "Bob")
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "select `id`,`name`,`age` from `t_usr` where `id`=?")
+			So(args, ShouldResemble, []interface{}{int64(2)})
+
+			o.Age = 21
+			n, err = tbl.UpdateByPK(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql, args = c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "update `t_usr` set `name`=?,`age`=? where `id`=?")
+			So(len(args), ShouldEqual, 3)
+			So(args[2], ShouldEqual, int64(2))
+
+			_, err = tbl.UpdateByPK(&o, Fields("age"), Where(Gt("age", 0)))
+			So(err, ShouldBeNil)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "update `t_usr` set `age`=? where `id`=? and `age`>?")
+
+			n, err = tbl.DeleteByPK(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql, args = c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "delete from `t_usr` where `id`=?")
+			So(args, ShouldResemble, []interface{}{int64(2)})
+
+			var ages []int64
+			_, err = tbl.Select(&ages, Fields("age"))
+			So(err, ShouldBeNil)
+			So(ages, ShouldResemble, []int64{18})
+		})
+
+		Convey("composite and embedded keys", func() {
+			type namedKey struct {
+				Name string `borm:"name,pk"`
+				Age  int64  `borm:"age,pk"`
+			}
+			type keyed struct {
+				namedKey
+				ID int64 `borm:"id"`
+			}
+
+			o := keyed{namedKey: namedKey{Name: "Alice", Age: 18}}
+			n, err := tbl.GetByPK(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(o.ID, ShouldEqual, 1)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEndWith, " from `t_usr` where `age`=? and `name`=?")
+			So(args, ShouldResemble, []interface{}{int64(18), "Alice"})
+
+			_, err = tbl.UpdateByPK(&o)
+			So(err, ShouldBeNil)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "update `t_usr` set `id`=? where `age`=? and `name`=?")
+		})
+
+		Convey("errors", func() {
+			n := len(c.Stmts())
+			_, err := tbl.GetByPK(&pkUser{})
+			So(err, ShouldNotBeNil)
+			_, err = tbl.UpdateByPK(&pkUser{Name: "Carol"})
+			So(err, ShouldNotBeNil)
+			_, err = tbl.DeleteByPK(&pkUser{})
+			So(err, ShouldNotBeNil)
+			_, err = tbl.DeleteByPK(&fakeUser{ID: 1})
+			So(err, ShouldNotBeNil)
+			_, err = tbl.DeleteByPK(pkUser{ID: 1})
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, n)
+		})
+	})
+}
+
+func TestAutoIncrement(t *testing.T) {
+	type autoUser struct {
+		ID   int64  `borm:"id,auto"`
+		Name string `borm:"name"`
+		Age  int64  `borm:"age"`
+	}
+	type autoUint struct {
+		ID   uint32 `borm:"id,pk,auto"`
+		Name string `borm:"name"`
+	}
+
+	Convey("auto tag", t, func() {
+		c, tbl := captureTable(t, "fake_auto", "t_usr")
+
+		Convey("single", func() {
+			o := autoUser{Name: "Alice", Age: 18}
+			n, err := tbl.Insert(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(o.ID, ShouldEqual, 1)
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?)")
+
+			o = autoUser{ID: 10, Name: "Bob"}
+			_, err = tbl.Insert(&o)
+			So(err, ShouldBeNil)
+			So(o.ID, ShouldEqual, 10)
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`id`,`name`,`age`) values (?,?,?)")
+
+			u := autoUint{Name: "Carol"}
+			_, err = tbl.Insert(&u)
+			So(err, ShouldBeNil)
+			So(u.ID, ShouldEqual, 11)
+		})
+
+		Convey("batch", func() {
+			_, err := tbl.Insert(&autoUser{Name: "Alice"})
+			So(err, ShouldBeNil)
+
+			o := []autoUser{{Name: "Bob"}, {Name: "Carol"}, {Name: "Dave"}}
+			n, err := tbl.Insert(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+			So([]int64{o[0].ID, o[1].ID, o[2].ID}, ShouldResemble, []int64{2, 3, 4})
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,?),(?,?)")
+
+			p := []*autoUser{{Name: "Eve"}, {Name: "Frank"}}
+			_, err = tbl.Insert(&p)
+			So(err, ShouldBeNil)
+			So([]int64{p[0].ID, p[1].ID}, ShouldResemble, []int64{5, 6})
+
+			// ids can't be told apart when rows are skipped
+			q := []autoUser{{Name: "Alice"}, {Name: "Grace"}}
+			n, err = tbl.InsertIgnore(&q)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So([]int64{q[0].ID, q[1].ID}, ShouldResemble, []int64{0, 0})
+
+			before := len(c.Stmts())
+			_, err = tbl.Insert(&[]autoUser{{ID: 20, Name: "Heidi"}, {Name: "Ivan"}})
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, before)
+
+			r := []autoUser{{ID: 20, Name: "Heidi"}, {ID: 21, Name: "Ivan"}}
+			_, err = tbl.Insert(&r)
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`id`,`name`,`age`) values (?,?,?),(?,?,?)")
+		})
+
+		Convey("returning", func() {
+			lite := Table(c, "t_usr").Dialect(SQLite)
+			o := []autoUser{{Name: "Alice"}, {Name: "Bob"}}
+			n, err := lite.Insert(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So([]int64{o[0].ID, o[1].ID}, ShouldResemble, []int64{1, 2})
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,?) returning `id`")
+
+			u := autoUint{Name: "Carol"}
+			n, err = lite.Insert(&u)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(u.ID, ShouldEqual, 3)
+
+			// the column of an inline field has the prefix
+			type key struct {
+				ID int64 `borm:"id,auto"`
+			}
+			type keyed struct {
+				Key  key    `borm:"usr_,inline"`
+				Name string `borm:"name"`
+			}
+			kc := NewBormCapture(nil)
+			Table(kc, "t_usr").Dialect(SQLite).Insert(&keyed{Name: "Dave"})
+			So(kc.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`) values (?) returning `usr_id`")
+		})
+	})
+}
+
+func TestOmitEmpty(t *testing.T) {
+	type oeUser struct {
+		ID    int64     `borm:"id,auto"`
+		Name  string    `borm:"name"`
+		Age   int64     `borm:"age,omitempty"`
+		Ctime time.Time `borm:"ctime,omitempty"`
+	}
+	type oePatch struct {
+		Name string `borm:"name,omitempty"`
+		Age  int64  `borm:"age,omitempty"`
+	}
+
+	Convey("omitempty tag", t, func() {
+		c, tbl := captureTable(t, "fake_omitempty", "t_usr")
+
+		Convey("insert", func() {
+			_, err := tbl.Insert(&oeUser{Name: "Alice"})
+			So(err, ShouldBeNil)
+			sql := c.Last().SQL
+			So(sql, ShouldEqual, "insert into `t_usr` (`name`) values (?)")
+
+			o := []oeUser{{Name: "Bob", Age: 20}, {Name: "Carol"}}
+			n, err := tbl.Insert(&o)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(o[1].ID, ShouldEqual, 3)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,default)")
+			So(len(args), ShouldEqual, 3)
+
+			_, err = tbl.Insert(&oeUser{Name: "Dave"}, Fields("name", "age"))
+			So(err, ShouldBeNil)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?)")
+
+			var ages []int64
+			_, err = tbl.Select(&ages, Fields("age"), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(ages, ShouldResemble, []int64{0, 20, 0, 0})
+		})
+
+		Convey("insert reused", func() {
+			// the columns and the rows with `default` differ by object at the same call
+			for _, o := range [][]oeUser{{{Name: "a", Age: 1}, {Name: "b"}}, {{Name: "c"}, {Name: "d", Age: 2}}, {{Name: "e"}}} {
+				_, err := tbl.Insert(&o)
+				So(err, ShouldBeNil)
+			}
+			stmts := c.Stmts()
+			So(stmts[len(stmts)-3].SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,default)")
+			So(stmts[len(stmts)-2].SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,default),(?,?)")
+			So(stmts[len(stmts)-1].SQL, ShouldEqual, "insert into `t_usr` (`name`) values (?)")
+			So(len(stmts[len(stmts)-2].Args), ShouldEqual, 3)
+		})
+
+		Convey("insert without default", func() {
+			lite := Table(c, "t_usr").Dialect(SQLite)
+			_, err := lite.Insert(&[]oeUser{{Name: "a", Age: 1}, {Name: "b"}})
+			So(err, ShouldBeNil)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,?) returning `id`")
+			So(len(args), ShouldEqual, 4)
+		})
+
+		Convey("update", func() {
+			_, err := tbl.Insert(&oeUser{Name: "Alice", Age: 18})
+			So(err, ShouldBeNil)
+
+			n, err := tbl.Update(&oePatch{Age: 30}, Where(Eq("name", "Alice")))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql := c.Last().SQL
+			So(sql, ShouldEqual, "update `t_usr` set `age`=? where `name`=?")
+
+			_, err = tbl.Update(&oePatch{Name: "Alicia"}, Fields("name", "age"), Where(Eq("name", "Alice")))
+			So(err, ShouldBeNil)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "update `t_usr` set `name`=?,`age`=? where `name`=?")
+
+			n = len(c.Stmts())
+			_, err = tbl.Update(&oePatch{}, Where(Eq("name", "Alicia")))
+			So(err, ShouldNotBeNil)
+			So(len(c.Stmts()), ShouldEqual, n)
+		})
+	})
+}
+
+func TestReadonly(t *testing.T) {
+	type roUser struct {
+		ID    int64     `borm:"id,auto,noupdate"`
+		Name  string    `borm:"name"`
+		Age   int64     `borm:"age,noupdate"`
+		Ctime time.Time `borm:"ctime,readonly"`
+	}
+
+	Convey("readonly and noupdate tags", t, func() {
+		c, tbl := captureTable(t, "fake_readonly", "t_usr")
+
+		o := roUser{Name: "Alice", Age: 18, Ctime: time.Now()}
+		_, err := tbl.Insert(&o)
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?)")
+
+		_, err = tbl.Update(V{"ctime": "2019-03-01 02:03:04"}, Where(Eq("id", o.ID)))
+		So(err, ShouldBeNil)
+
+		o.Name, o.Age = "Alicia", 30
+		n, err := tbl.Update(&o, Where(Eq("id", o.ID)))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(c.Last().SQL, ShouldEqual, "update `t_usr` set `name`=? where `id`=?")
+
+		var r roUser
+		n, err = tbl.Select(&r, Where(Eq("id", o.ID)))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(r.Name, ShouldEqual, "Alicia")
+		So(r.Age, ShouldEqual, 18)
+		So(r.Ctime.Year(), ShouldEqual, 2019)
+
+		Convey("on duplicate key update", func() {
+			p := []roUser{{Name: "Alicia", Age: 40}, {Name: "Bob", Age: 20}}
+			_, err := tbl.Insert(&p, OnDuplicateKeyUpdateAll())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?),(?,?) on duplicate key update `name`=values(`name`)")
+
+			_, err = tbl.Insert(&fakeUser{Name: "Bob", Age: 21}, Fields("name", "age"), OnDuplicateKeyUpdateAll())
+			So(err, ShouldBeNil)
+			So(c.Last().SQL, ShouldEqual, "insert into `t_usr` (`name`,`age`) values (?,?) on duplicate key update `name`=values(`name`),`age`=values(`age`)")
+
+			var ages []int64
+			_, err = tbl.Select(&ages, Fields("age"), OrderBy("id"))
+			So(err, ShouldBeNil)
+			So(ages, ShouldResemble, []int64{18, 21})
+
+			type doc struct {
+				ID    int64     `borm:"id,pk"`
+				Name  string    `borm:"name"`
+				Ctime time.Time `borm:"ctime,autoCreateTime"`
+				Mtime time.Time `borm:"mtime,autoUpdateTime"`
+				Ver   int64     `borm:"ver,version"`
+				Dtime int64     `borm:"dtime,softDelete"`
+			}
+			dc := NewBormCapture(nil)
+			Table(dc, "t_doc").Insert(&doc{ID: 1, Name: "a"}, OnDuplicateKeyUpdateAll())
+			So(dc.Last().SQL, ShouldEndWith, " on duplicate key update `name`=values(`name`),`mtime`=values(`mtime`)")
+		})
+	})
+}
+
+func TestAutoTime(t *testing.T) {
+	type tsDoc struct {
+		Name  string    `borm:"name"`
+		Ctime time.Time `borm:"ctime,autoCreateTime"`
+		Mtime int64     `borm:"mtime,autoUpdateTime,milli"`
+		Utime int64     `borm:"utime,autoUpdateTime"`
+	}
+
+	Convey("autoCreateTime and autoUpdateTime", t, func() {
+		c, tbl := captureTable(t, "fake_autotime", "t_doc", "create table `t_doc` (`name` varchar(64) not null, `ctime` datetime, `mtime` bigint not null default 0, `utime` bigint not null default 0, primary key (`name`))")
+
+		now := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+		tbl.Clock(func() time.Time { return now })
+
+		d := tsDoc{Name: "a"}
+		_, err := tbl.Insert(&d)
+		So(err, ShouldBeNil)
+		So(d.Ctime, ShouldEqual, now)
+		So(d.Mtime, ShouldEqual, now.UnixMilli())
+		So(d.Utime, ShouldEqual, now.Unix())
+		So(c.Last().Args[1], ShouldEqual, "2020-01-02 03:04:05")
+
+		// a set create time is kept
+		old := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+		ds := []*tsDoc{{Name: "b", Ctime: old}, {Name: "c"}}
+		_, err = tbl.Insert(&ds)
+		So(err, ShouldBeNil)
+		So(ds[0].Ctime, ShouldEqual, old)
+		So(ds[1].Ctime, ShouldEqual, now)
+		So(ds[0].Utime, ShouldEqual, now.Unix())
+
+		now = now.Add(time.Hour)
+		_, err = tbl.Update(&d, Where(Eq("name", "a")))
+		So(err, ShouldBeNil)
+		So(d.Ctime, ShouldEqual, now.Add(-time.Hour))
+		So(d.Utime, ShouldEqual, now.Unix())
+
+		var r tsDoc
+		_, err = Table(c, "t_doc").Select(&r, Where(Eq("name", "a")))
+		So(err, ShouldBeNil)
+		So(r.Ctime.Equal(now.Add(-time.Hour).Truncate(time.Second)), ShouldBeTrue)
+		So(r.Mtime, ShouldEqual, now.UnixMilli())
+		So(r.Utime, ShouldEqual, now.Unix())
+
+		Convey("timestamp", func() {
+			d := tsDoc{Name: "d"}
+			_, err := Table(c, "t_doc").ToTimestamp().Clock(func() time.Time { return now }).Insert(&d)
+			So(err, ShouldBeNil)
+			So(c.Last().Args[1], ShouldEqual, now.Unix())
+		})
+
+		Convey("pointers and 32-bit integers", func() {
+			type audit struct {
+				Mtime uint32 `borm:"mtime,autoUpdateTime"`
+			}
+			type ptrDoc struct {
+				Name   string     `borm:"name"`
+				Ctime  *time.Time `borm:"ctime,autoCreateTime"`
+				Utime  int32      `borm:"utime,autoUpdateTime"`
+				*audit `borm:",inline"`
+			}
+			tbl.Clock(func() time.Time { return now })
+			d := ptrDoc{Name: "e", audit: &audit{}}
+			_, err := tbl.Insert(&d)
+			So(err, ShouldBeNil)
+			So(*d.Ctime, ShouldEqual, now)
+			So(d.Utime, ShouldEqual, now.Unix())
+			So(d.Mtime, ShouldEqual, now.Unix())
+
+			// nowhere to write the time
+			_, err = tbl.Insert(&ptrDoc{Name: "f"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "nil pointer")
+
+			type badDoc struct {
+				Name  string `borm:"name"`
+				Utime int16  `borm:"utime,autoUpdateTime"`
+				Mtime int32  `borm:"mtime,autoUpdateTime,milli"`
+			}
+			_, err = tbl.Insert(&badDoc{Name: "g"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "not supported")
+		})
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	type post struct {
+		ID        int64     `borm:"id,pk,auto"`
+		Title     string    `borm:"title"`
+		DeletedAt time.Time `borm:"deleted_at,softDelete"`
+	}
+	type flagged struct {
+		ID    int64  `borm:"id,pk,auto"`
+		Title string `borm:"title"`
+		IsDel bool   `borm:"is_del,softDelete"`
+	}
+
+	Convey("soft delete", t, func() {
+		c, tbl := captureTable(t, "fake_softdelete", "t_post", "create table `t_post` (`id` bigint not null auto_increment, `title` varchar(64) not null default '', `deleted_at` datetime, `is_del` tinyint not null default 0, primary key (`id`))")
+
+		now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		tbl.Clock(func() time.Time { return now })
+		_, err := tbl.Insert(&[]post{{Title: "a"}, {Title: "b"}, {Title: "c"}})
+		So(err, ShouldBeNil)
+
+		// the zero value of the column would insert deleted rows
+		sql := c.Last().SQL
+		So(sql, ShouldEqual, "insert into `t_post` (`title`) values (?),(?),(?)")
+		n, err := tbl.Select(&[]post{})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 3)
+
+		Convey("timestamp", func() {
+			n, err := tbl.DeleteByPK(&post{ID: 1})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "update `t_post` set `deleted_at`=? where `deleted_at` is null and `id`=?")
+			So(args[0], ShouldEqual, "2020-01-02 03:04:05")
+
+			// deleted twice is a no-op
+			n, err = tbl.DeleteByPK(&post{ID: 1})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+
+			var ps []post
+			_, err = tbl.Select(&ps, Where("id>? or title=?", 0, "a"))
+			So(err, ShouldBeNil)
+			So(len(ps), ShouldEqual, 2)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "select `id`,`title`,`deleted_at` from `t_post` where `deleted_at` is null and (id>? or title=?)")
+
+			ps = nil
+			_, err = Table(c, "t_post").Unscoped().Select(&ps)
+			So(err, ShouldBeNil)
+			So(len(ps), ShouldEqual, 3)
+			So(ps[0].DeletedAt.Equal(now), ShouldBeTrue)
+			So(ps[1].DeletedAt.IsZero(), ShouldBeTrue)
+
+			n, err = tbl.UpdateByPK(&post{ID: 1, Title: "x"})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "update `t_post` set `title`=? where `deleted_at` is null and `id`=?")
+
+			// the zero column of the struct doesn't undo or redo deletion
+			n, err = tbl.UpdateByPK(&post{ID: 2, Title: "y"})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			var live []post
+			_, err = tbl.Select(&live)
+			So(err, ShouldBeNil)
+			So(len(live), ShouldEqual, 2)
+
+			// tables without a struct are told the column
+			var cnt int64
+			_, err = Table(c, "t_post").SoftDelete(post{}).Select(&cnt, Fields("count(1)"))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 2)
+
+			_, err = Table(c, "t_post").SoftDelete(post{}).Delete(Where(Eq("title", "b")))
+			So(err, ShouldBeNil)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "update `t_post` set `deleted_at`=? where `deleted_at` is null and `title`=?")
+
+			n, err = Table(c, "t_post").SoftDelete(post{}).HardDelete(Where(Eq("id", 1)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql = c.Last().SQL
+			So(sql, ShouldEqual, "delete from `t_post` where `id`=?")
+
+			_, err = Table(c, "t_post").Unscoped().Select(&cnt, Fields("count(1)"))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 2)
+		})
+
+		Convey("flag", func() {
+			n, err := tbl.DeleteByPK(&flagged{ID: 2})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "update `t_post` set `is_del`=? where `is_del`=? and `id`=?")
+			So(args[0], ShouldEqual, 1)
+
+			var fs []flagged
+			_, err = Table(c, "t_post").AutoQualify().Select(&fs, InnerJoin("t_post", "p", Cond("`p`.`id`=`t_post`.`id`")))
+			So(err, ShouldBeNil)
+			So(len(fs), ShouldEqual, 2)
+			sql = c.Last().SQL
+			So(sql, ShouldEndWith, " where `t_post`.`is_del`=?")
+		})
+
+		Convey("column cache", func() {
+			st := reflect2.TypeOf(post{}).(reflect2.StructType)
+			sf := tbl.structFields(st)
+
+			// the scoped table maps columns with the cache of tbl
+			So(tbl.scoped(&post{}).structFields(st), ShouldPointTo, sf)
+			_, err := tbl.Select(&[]post{})
+			So(err, ShouldBeNil)
+			So(tbl.structFields(st), ShouldPointTo, sf)
+		})
+	})
+}
+
+func TestVersion(t *testing.T) {
+	type cfg struct {
+		ID      int64  `borm:"id,pk,auto"`
+		Val     string `borm:"val"`
+		Version int64  `borm:"version,version"`
+	}
+
+	Convey("optimistic locking", t, func() {
+		c, tbl := captureTable(t, "fake_version", "t_cfg", "create table `t_cfg` (`id` bigint not null auto_increment, `val` varchar(64) not null default '', `version` int not null default 0, primary key (`id`))")
+
+		o := cfg{Val: "a"}
+		_, err := tbl.Insert(&o)
+		So(err, ShouldBeNil)
+
+		var a, b cfg
+		a.ID, b.ID = o.ID, o.ID
+		_, err = tbl.GetByPK(&a)
+		So(err, ShouldBeNil)
+		_, err = tbl.GetByPK(&b)
+		So(err, ShouldBeNil)
+
+		a.Val = "b"
+		n, err := tbl.UpdateByPK(&a)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(a.Version, ShouldEqual, 1)
+		sql, args := c.Last().SQL, c.Last().Args
+		So(sql, ShouldEqual, "update `t_cfg` set `val`=?,`version`=`version`+1 where `id`=? and `version`=?")
+		So(args[len(args)-1], ShouldEqual, int64(0))
+
+		b.Val = "c"
+		n, err = tbl.UpdateByPK(&b)
+		So(err, ShouldEqual, ErrStaleObject)
+		So(n, ShouldEqual, 0)
+		So(b.Version, ShouldEqual, 0)
+
+		_, err = tbl.Update(&a, Fields("version", "val"), Where(Eq("id", a.ID)))
+		So(err, ShouldBeNil)
+		So(a.Version, ShouldEqual, 2)
+		sql = c.Last().SQL
+		So(sql, ShouldEqual, "update `t_cfg` set `val`=?,`version`=`version`+1 where `id`=? and `version`=?")
+
+		var r cfg
+		_, err = tbl.Select(&r, Where(Eq("id", a.ID)))
+		So(err, ShouldBeNil)
+		So(r.Val, ShouldEqual, "b")
+		So(r.Version, ShouldEqual, 2)
+
+		// the same call again, with the statement reused
+		for i, v := range []string{"d", "e"} {
+			a.Val = v
+			n, err = tbl.UpdateByPK(&a)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(a.Version, ShouldEqual, 3+i)
+		}
+		b.Val = "f"
+		for i := 0; i < 2; i++ {
+			_, err = tbl.UpdateByPK(&b)
+			So(err, ShouldEqual, ErrStaleObject)
+		}
+
+		before := len(c.Stmts())
+		_, err = tbl.Update(&a, Fields("val", "nope"), Where(Eq("id", a.ID)))
+		So(err, ShouldNotBeNil)
+		So(len(c.Stmts()), ShouldEqual, before)
+
+		Convey("under an embedded pointer", func() {
+			type Base struct {
+				ID      int64 `borm:"id,pk,auto"`
+				Version int64 `borm:"version,version"`
+			}
+			type vcfg struct {
+				*Base
+				Val string `borm:"val"`
+			}
+
+			d := vcfg{Base: &Base{}, Val: "x"}
+			_, err := tbl.Insert(&d)
+			So(err, ShouldBeNil)
+			for i, v := range []string{"y", "z"} {
+				d.Val = v
+				n, err := tbl.UpdateByPK(&d)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 1)
+				So(d.Version, ShouldEqual, 1+i)
+				args := c.Last().Args
+				So(args[len(args)-1], ShouldEqual, int64(i))
+			}
+
+			before := len(c.Stmts())
+			_, err = tbl.Update(&vcfg{Val: "w"}, Where(Eq("id", d.ID)))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "field Version tagged version is under a nil pointer")
+			So(len(c.Stmts()), ShouldEqual, before)
+		})
+	})
+}
+
+func TestInline(t *testing.T) {
+	type address struct {
+		Street string `borm:"street"`
+		City   string `borm:"city"`
+	}
+	type shop struct {
+		ID   int64    `borm:"id,pk,auto"`
+		Name string   `borm:"name"`
+		Addr address  `borm:"addr_,inline"`
+		Bill *address `borm:"bill_,inline"`
+	}
+
+	Convey("inline nested structs", t, func() {
+		c, tbl := captureTable(t, "fake_inline", "t_shop", "create table `t_shop` (`id` bigint not null auto_increment, `name` varchar(64) not null default '', `addr_street` varchar(64), `addr_city` varchar(64), `bill_street` varchar(64), `bill_city` varchar(64), primary key (`id`))")
+
+		o := []shop{
+			{Name: "a", Addr: address{"1st", "X"}},
+			{Name: "b", Addr: address{"2nd", "Y"}, Bill: &address{"3rd", "Z"}},
+		}
+		_, err := tbl.Insert(&o)
+		So(err, ShouldBeNil)
+		sql, args := c.Last().SQL, c.Last().Args
+		So(sql, ShouldEqual, "insert into `t_shop` (`name`,`addr_street`,`addr_city`,`bill_street`,`bill_city`) values (?,?,?,?,?),(?,?,?,?,?)")
+		So(args[3], ShouldBeNil)
+		So(args[4], ShouldBeNil)
+
+		var r []shop
+		n, err := tbl.Select(&r, OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		sql = c.Last().SQL
+		So(sql, ShouldEqual, "select `id`,`name`,`addr_street`,`addr_city`,`bill_street`,`bill_city` from `t_shop` order by `id`")
+		So(r[0].Addr, ShouldResemble, address{"1st", "X"})
+		So(r[0].Bill, ShouldBeNil)
+		So(r[1].Bill, ShouldResemble, &address{"3rd", "Z"})
+
+		r[0].Addr.City = "W"
+		r[0].Bill = &address{City: "V"}
+		_, err = tbl.UpdateByPK(&r[0])
+		So(err, ShouldBeNil)
+		sql = c.Last().SQL
+		So(sql, ShouldEqual, "update `t_shop` set `name`=?,`addr_street`=?,`addr_city`=?,`bill_street`=?,`bill_city`=? where `id`=?")
+
+		var cities []string
+		_, err = tbl.Select(&cities, Fields("bill_city"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(cities, ShouldResemble, []string{"V", "Z"})
+
+		Convey("fields", func() {
+			_, err := tbl.Update(&shop{Addr: address{City: "U"}}, Fields("addr_city"), Where(Eq("id", 1)))
+			So(err, ShouldBeNil)
+			sql := c.Last().SQL
+			So(sql, ShouldEqual, "update `t_shop` set `addr_city`=? where `id`=?")
+
+			var s shop
+			_, err = tbl.Select(&s, Fields("name", "addr_city"), Where(Eq("id", 1)))
+			So(err, ShouldBeNil)
+			So(s.Addr.City, ShouldEqual, "U")
+
+			_, err = tbl.Select(&s, Fields("bill_city"), Where(Eq("id", 1)))
+			So(err, ShouldBeNil)
+			So(s.Bill, ShouldResemble, &address{City: "V"})
+		})
+
+		Convey("on duplicate key update all", func() {
+			_, err := tbl.Insert(&shop{ID: 1, Name: "a", Addr: address{"4th", "Q"}}, OnDuplicateKeyUpdateAll())
+			So(err, ShouldBeNil)
+			sql := c.Last().SQL
+			So(sql, ShouldEqual, "insert into `t_shop` (`id`,`name`,`addr_street`,`addr_city`,`bill_street`,`bill_city`) values (?,?,?,?,?,?) on duplicate key update `name`=values(`name`),`addr_street`=values(`addr_street`),`addr_city`=values(`addr_city`),`bill_street`=values(`bill_street`),`bill_city`=values(`bill_city`)")
+
+			var s shop
+			_, err = tbl.Select(&s, Where(Eq("id", 1)))
+			So(err, ShouldBeNil)
+			So(s.Addr, ShouldResemble, address{"4th", "Q"})
+			So(s.Bill, ShouldBeNil)
+		})
+	})
+}
+
+// TestEmbedded tests embedded struct pointers
+func TestEmbedded(t *testing.T) {
+	type stamp struct {
+		Ctime int64 `borm:"ctime"`
+	}
+	type base struct {
+		ID int64 `borm:"id,pk,auto"`
+		*stamp
+	}
+	type note struct {
+		Title string `borm:"title"`
+		*base
+	}
+
+	Convey("embedded struct pointers", t, func() {
+		c, tbl := captureTable(t, "fake_embedded", "t_note", "create table `t_note` (`id` bigint not null auto_increment, `title` varchar(64) not null default '', `ctime` bigint, primary key (`id`))")
+
+		o := []note{
+			{Title: "a"},
+			{Title: "b", base: &base{stamp: &stamp{Ctime: 100}}},
+		}
+		_, err := tbl.Insert(&o)
+		So(err, ShouldBeNil)
+		sql, args := c.Last().SQL, c.Last().Args
+		So(sql, ShouldEqual, "insert into `t_note` (`title`,`ctime`) values (?,?),(?,?)")
+		So(args[1], ShouldBeNil)
+		So(o[1].ID, ShouldEqual, 2)
+
+		var r []note
+		n, err := tbl.Select(&r, OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		sql = c.Last().SQL
+		So(sql, ShouldEqual, "select `title`,`id`,`ctime` from `t_note` order by `id`")
+		So(r[0].base, ShouldResemble, &base{ID: 1})
+		So(r[1].base, ShouldResemble, &base{ID: 2, stamp: &stamp{Ctime: 100}})
+
+		var ctimes []note
+		_, err = tbl.Select(&ctimes, Fields("ctime"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(ctimes[0].base, ShouldBeNil)
+		So(ctimes[1].base, ShouldResemble, &base{stamp: &stamp{Ctime: 100}})
+
+		r[0].Title = "c"
+		r[0].stamp = &stamp{Ctime: 200}
+		_, err = tbl.UpdateByPK(&r[0])
+		So(err, ShouldBeNil)
+		sql = c.Last().SQL
+		So(sql, ShouldEqual, "update `t_note` set `title`=?,`ctime`=? where `id`=?")
+
+		var x note
+		_, err = tbl.Select(&x, Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(x.Title, ShouldEqual, "c")
+		So(x.Ctime, ShouldEqual, 200)
+
+		Convey("conflicts", func() {
+			type other struct {
+				Title string `borm:"title"`
+				Ctime int64  `borm:"ctime"`
+			}
+			type outer struct {
+				Title string `borm:"title"`
+				*other
+				*stamp
+			}
+			var y outer
+			_, err := tbl.Select(&y, Where(Eq("id", 2)))
+			So(err, ShouldBeNil)
+			sql := c.Last().SQL
+			So(sql, ShouldEqual, "select `title` from `t_note` where `id`=?")
+			So(y.Title, ShouldEqual, "b")
+			So(y.other, ShouldBeNil)
+		})
+
+		Convey("struct under a nil pointer", func() {
+			type meta struct {
+				stamp
+			}
+			type memo struct {
+				Title string `borm:"title"`
+				*meta
+			}
+			_, err := tbl.Insert(&memo{Title: "d"})
+			So(err, ShouldBeNil)
+			sql, args := c.Last().SQL, c.Last().Args
+			So(sql, ShouldEqual, "insert into `t_note` (`title`,`ctime`) values (?,?)")
+			So(args[1], ShouldBeNil)
+		})
+
+		Convey("self-referencing pointer", func() {
+			type rvNode struct {
+				*rvNode
+				ID int64 `borm:"id"`
+			}
+			var y rvNode
+			n, err := tbl.Select(&y, Where(Eq("id", 2)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(c.Last().SQL, ShouldEqual, "select `id` from `t_note` where `id`=?")
+			So(y.ID, ShouldEqual, 2)
+			So(y.rvNode, ShouldBeNil)
+		})
+	})
+}
+
+// TestNaming tests naming strategies of untagged fields
+func TestNaming(t *testing.T) {
+	Convey("naming strategies", t, func() {
+		for name, want := range map[string][3]string{
+			"Name":       {"name", "name", "name"},
+			"UserName":   {"user_name", "userName", "username"},
+			"UserID":     {"user_id", "userID", "userid"},
+			"HTTPServer": {"http_server", "httpServer", "httpserver"},
+			"ID":         {"id", "id", "id"},
+			"Addr2City":  {"addr2_city", "addr2City", "addr2city"},
+			"user_Name":  {"user_name", "user_Name", "user_name"},
+		} {
+			So(SnakeCase(name), ShouldEqual, want[0])
+			So(CamelCase(name), ShouldEqual, want[1])
+			So(LowerCase(name), ShouldEqual, want[2])
+		}
+
+		type member struct {
+			ID       int64 `borm:"id,pk,auto"`
+			UserName string
+			HTTPCode int
+			Note     string `borm:"remark"`
+		}
+
+		c, tbl := captureTable(t, "fake_naming", "t_member", "create table `t_member` (`id` bigint not null auto_increment, `user_name` varchar(64) not null default '', `http_code` int, `remark` varchar(64), primary key (`id`))")
+		tbl.Naming(SnakeCase)
+
+		_, err := tbl.Insert(&member{UserName: "a", HTTPCode: 200, Note: "x"})
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEqual, "insert into `t_member` (`user_name`,`http_code`,`remark`) values (?,?,?)")
+
+		var m member
+		_, err = tbl.Select(&m, Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEqual, "select `id`,`user_name`,`http_code`,`remark` from `t_member` where `id`=?")
+		So(m, ShouldResemble, member{ID: 1, UserName: "a", HTTPCode: 200, Note: "x"})
+
+		m.HTTPCode = 404
+		_, err = tbl.Update(&m, Fields("http_code"), Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(c.Last().SQL, ShouldEqual, "update `t_member` set `http_code`=? where `id`=?")
+
+		var codes []int
+		_, err = tbl.Select(&codes, Fields("http_code"))
+		So(err, ShouldBeNil)
+		So(codes, ShouldResemble, []int{404})
+
+		Convey("field map cache", func() {
+			s := reflect2.TypeOf(member{}).(reflect2.StructType)
+			So(tbl.getStructFieldMap(s)["user_name"], ShouldNotBeNil)
+			// tags are parsed once per table and struct
+			So(tbl.getStructFieldMap(s)["id"].Opts.Contains("auto"), ShouldBeTrue)
+			So(&tbl.structColumns(s)[0], ShouldEqual, &tbl.structColumns(s)[0])
+
+			tbl.Naming(CamelCase)
+			So(tbl.getStructFieldMap(s)["userName"], ShouldNotBeNil)
+			So(tbl.getStructFieldMap(s)["user_name"], ShouldBeNil)
+
+			prefix := func(p string) func(string) string {
+				return func(name string) string { return p + SnakeCase(name) }
+			}
+			tbl.Naming(prefix("m_"))
+			So(tbl.getStructFieldMap(s)["m_user_name"], ShouldNotBeNil)
+			tbl.Naming(prefix("n_"))
+			So(tbl.getStructFieldMap(s)["n_user_name"], ShouldNotBeNil)
+		})
+
+		Convey("reuse key", func() {
+			cs := &CallSite{Key: "borm_test.go:1"}
+			prefix := func(p string) func(string) string {
+				return func(name string) string { return p + SnakeCase(name) }
+			}
+			key := func(t *BormTable) string { return t.reuseKey(cs, "Select", &[]member{}, nil) }
+			So(key(Table(c, "t_member").Naming(SnakeCase)), ShouldEqual, key(Table(c, "t_member").Naming(SnakeCase)))
+			So(key(Table(c, "t_member").Naming(SnakeCase)), ShouldNotEqual, key(Table(c, "t_member").Naming(CamelCase)))
+			So(key(Table(c, "t_member").Naming(prefix("m_"))), ShouldNotEqual, key(Table(c, "t_member").Naming(prefix("n_"))))
+			So(key(Table(c, "t_member")), ShouldNotEqual, key(Table(c, "t_member").AutoQualify()))
+			So(key(Table(c, "t_member")), ShouldNotEqual, key(Table(c, "t_member").Dialect(SQLite)))
+			So(key(Table(c, "t_member")), ShouldEqual, key(Table(c, "t_member").Dialect(MySQL)))
+			direct := Table(c, "t_member").Dialect(MySQL57)
+			direct.Cfg.Dialect = SQLite
+			So(key(direct), ShouldEqual, key(Table(c, "t_member").Dialect(SQLite)))
+			So(key(Table(c, "t_member")), ShouldNotEqual, key(Table(c, "t_other")))
+		})
+	})
+}
+
 // TestEdgeCases tests edge cases and boundary conditions
 func TestEdgeCases(t *testing.T) {
 	Convey("Test edge cases", t, func() {
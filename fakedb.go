@@ -0,0 +1,3412 @@
+/*
+   borm is a better orm library for Go.
+
+  Copyright (c) 2019 <http://ez8.co> <orca.zhang@yahoo.com>
+
+  This library is released under the MIT License.
+  Please see LICENSE file or visit https://github.com/orca-zhang/borm for details.
+*/
+
+package borm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+   In-memory fake database
+
+   A pure-Go database/sql driver that understands the subset of MySQL that borm
+   generates, so that tests can run with `go test` and no external services:
+
+      db, _ := sql.Open(borm.FakeDriverName, "my_test")
+      db.Exec("create table t_usr (id bigint auto_increment primary key, name varchar(64))")
+      n, err := borm.Table(db, "t_usr").Insert(&o)
+
+   Every DSN names an independent database that lives as long as the process,
+   or until ResetFakeDB is called. Tables are created by `create table`. As in
+   InnoDB, a statement that fails changes nothing.
+*/
+
+// FakeDriverName is the name the in-memory driver is registered under
+const FakeDriverName = "borm_fake"
+
+func init() {
+	sql.Register(FakeDriverName, &fakeDriver{})
+}
+
+var _fakeDBs sync.Map // map[string]*fakeDB
+
+// ResetFakeDB drops all tables of the fake database named by dsn
+func ResetFakeDB(dsn string) {
+	if v, ok := _fakeDBs.Load(dsn); ok {
+		d := v.(*fakeDB)
+		d.mu.Lock()
+		d.state = newFakeState()
+		d.mu.Unlock()
+	}
+}
+
+type fakeDriver struct{}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	v, _ := _fakeDBs.LoadOrStore(dsn, &fakeDB{state: newFakeState()})
+	return &fakeConn{db: v.(*fakeDB)}, nil
+}
+
+type fakeDB struct {
+	mu    sync.Mutex
+	state *fakeState
+}
+
+type fakeState struct {
+	tables map[string]*fakeTable
+}
+
+func newFakeState() *fakeState {
+	return &fakeState{tables: make(map[string]*fakeTable)}
+}
+
+func (s *fakeState) clone() *fakeState {
+	c := newFakeState()
+	for k, t := range s.tables {
+		c.tables[k] = t.clone()
+	}
+	return c
+}
+
+func (s *fakeState) table(name string) (*fakeTable, error) {
+	if t, ok := s.tables[strings.ToLower(name)]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("fake: table '%s' doesn't exist", name)
+}
+
+type fakeColumn struct {
+	Name    string
+	Kind    int
+	AutoInc bool
+	NotNull bool
+	Default fakeExpr
+}
+
+const (
+	_fakeAny = iota
+	_fakeInt
+	_fakeUint
+	_fakeFloat
+	_fakeString
+	_fakeTime
+)
+
+type fakeTable struct {
+	Name    string
+	Cols    []*fakeColumn
+	Keys    [][]string // Keys[0] is the primary key if hasPK
+	hasPK   bool
+	autoInc int64
+	rows    []map[string]driver.Value
+}
+
+func (t *fakeTable) clone() *fakeTable {
+	c := *t
+	c.Cols = append([]*fakeColumn(nil), t.Cols...)
+	c.rows = make([]map[string]driver.Value, len(t.rows))
+	for i, r := range t.rows {
+		c.rows[i] = copyFakeRow(r)
+	}
+	return &c
+}
+
+func copyFakeRow(r map[string]driver.Value) map[string]driver.Value {
+	c := make(map[string]driver.Value, len(r))
+	for k, v := range r {
+		c[k] = v
+	}
+	return c
+}
+
+func (t *fakeTable) col(name string) *fakeColumn {
+	for _, c := range t.Cols {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (t *fakeTable) autoCol() *fakeColumn {
+	for _, c := range t.Cols {
+		if c.AutoInc {
+			return c
+		}
+	}
+	return nil
+}
+
+// conflict returns the index of the first row other than skip sharing a unique key with r
+func (t *fakeTable) conflict(r map[string]driver.Value, skip int) (int, string) {
+	for ki, key := range t.Keys {
+		for i, row := range t.rows {
+			if i == skip {
+				continue
+			}
+			same := true
+			for _, k := range key {
+				if r[k] == nil || row[k] == nil {
+					same = false
+					break
+				}
+				if c, ok := fakeCompare(r[k], row[k]); !ok || c != 0 {
+					same = false
+					break
+				}
+			}
+			if same {
+				name := strings.Join(key, ",")
+				if ki == 0 && t.hasPK {
+					name = "PRIMARY"
+				}
+				return i, name
+			}
+		}
+	}
+	return -1, ""
+}
+
+func (t *fakeTable) coerce(c *fakeColumn, v driver.Value) driver.Value {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			v = int64(1)
+		} else {
+			v = int64(0)
+		}
+	}
+	if v == nil || c == nil {
+		return v
+	}
+	switch c.Kind {
+	case _fakeInt, _fakeUint:
+		switch x := v.(type) {
+		case float64:
+			return int64(x)
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+				return i
+			}
+			if u, err := strconv.ParseUint(strings.TrimSpace(x), 10, 64); err == nil {
+				return u
+			}
+		case time.Time:
+			return x.Unix()
+		}
+	case _fakeFloat:
+		switch x := v.(type) {
+		case int64:
+			return float64(x)
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return f
+			}
+		}
+	case _fakeString:
+		switch x := v.(type) {
+		case int64, uint64, float64:
+			return fmt.Sprint(x)
+		case time.Time:
+			return x.Format(_timeLayout)
+		}
+	case _fakeTime:
+		switch x := v.(type) {
+		case int64:
+			return time.Unix(x, 0).UTC()
+		case string:
+			if tm, err := parseTimeString(x); err == nil {
+				return tm
+			}
+		}
+	}
+	return v
+}
+
+type fakeConn struct {
+	db     *fakeDB
+	tx     *fakeState
+	writes []interface{} // the statements changing tx, replayed by Commit
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("fake: transaction already started")
+	}
+	c.db.mu.Lock()
+	c.tx = c.db.state.clone()
+	c.db.mu.Unlock()
+	return &fakeTx{c: c}, nil
+}
+
+// CheckNamedValue lets uint64 values with the high bit set through, as the mysql driver does
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case uint64:
+		return nil
+	case *uint64:
+		if v == nil {
+			nv.Value = nil
+		} else {
+			nv.Value = *v
+		}
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(query, args)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(query, args)
+}
+
+func (c *fakeConn) run(query string, args []driver.NamedValue, f func(s *fakeState, stmt interface{}) error) error {
+	stmt, err := parseFakeSQL(query, args)
+	if err != nil {
+		return err
+	}
+	s := &c.tx
+	if c.tx == nil {
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		s = &c.db.state
+	}
+	if !fakeWrites(stmt) {
+		return f(*s, stmt)
+	}
+	// the statement runs against a copy, kept only if it succeeds
+	ns := (*s).clone()
+	if err := f(ns, stmt); err != nil {
+		return err
+	}
+	*s = ns
+	if c.tx != nil {
+		c.writes = append(c.writes, stmt)
+	}
+	return nil
+}
+
+// fakeWrites reports whether stmt may change the database
+func fakeWrites(stmt interface{}) bool {
+	switch st := stmt.(type) {
+	case *fakeSelect:
+		return false
+	case *fakeWith:
+		return fakeWrites(st.Stmt)
+	}
+	return true
+}
+
+func (c *fakeConn) exec(query string, args []driver.NamedValue) (res driver.Result, err error) {
+	err = c.run(query, args, func(s *fakeState, stmt interface{}) error {
+		res, err = execFakeStmt(s, stmt)
+		return err
+	})
+	return
+}
+
+func (c *fakeConn) query(query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = c.run(query, args, func(s *fakeState, stmt interface{}) error {
+		if w, ok := stmt.(*fakeWith); ok {
+			ws, err := w.bind(s)
+			if err != nil {
+				return err
+			}
+			s, stmt = ws, w.Stmt
+		}
+		if sel, ok := stmt.(*fakeSelect); ok {
+			cols, data, err := sel.run(s, nil)
+			if err != nil {
+				return err
+			}
+			rows = &fakeRows{cols: cols, data: data}
+			return nil
+		}
+		res, err := execFakeStmt(s, stmt)
+		if err != nil {
+			return err
+		}
+		if ins, ok := stmt.(*fakeInsert); ok && len(ins.Returning) > 0 {
+			rows = &fakeRows{cols: ins.Returning, data: res.(*fakeResult).returning}
+			return nil
+		}
+		rows = &fakeRows{}
+		return nil
+	})
+	return
+}
+
+type fakeTx struct {
+	c *fakeConn
+}
+
+// Commit replays the statements of the transaction on the database, so that writes committed
+// outside of it meanwhile are kept. If one fails, the database is left unchanged
+func (tx *fakeTx) Commit() error {
+	if tx.c.tx == nil {
+		return sql.ErrTxDone
+	}
+	writes := tx.c.writes
+	tx.c.tx, tx.c.writes = nil, nil
+
+	tx.c.db.mu.Lock()
+	defer tx.c.db.mu.Unlock()
+	s := tx.c.db.state.clone()
+	for _, stmt := range writes {
+		if _, err := execFakeStmt(s, stmt); err != nil {
+			return err
+		}
+	}
+	tx.c.db.state = s
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	if tx.c.tx == nil {
+		return sql.ErrTxDone
+	}
+	tx.c.tx, tx.c.writes = nil, nil
+	return nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.exec(s.query, fakeNamedValues(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.query(s.query, fakeNamedValues(args))
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.exec(s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.query(s.query, args)
+}
+
+func fakeNamedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+type fakeResult struct {
+	lastID    int64
+	affected  int64
+	returning [][]driver.Value // rows of `returning`, for inserted or updated rows
+}
+
+func (r *fakeResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r *fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type fakeRows struct {
+	cols []string
+	data [][]driver.Value
+	i    int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.i])
+	r.i++
+	return nil
+}
+
+/*
+   Tokenizer
+*/
+
+const (
+	_fakeTokEOF = iota
+	_fakeTokIdent
+	_fakeTokQuoted
+	_fakeTokString
+	_fakeTokNumber
+	_fakeTokParam
+	_fakeTokSym
+)
+
+type fakeTok struct {
+	kind int
+	s    string
+	pos  int
+	end  int
+}
+
+func fakeTokenize(q string) ([]fakeTok, error) {
+	var toks []fakeTok
+	i := 0
+	for i < len(q) {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '/' && i+1 < len(q) && q[i+1] == '*':
+			end := strings.Index(q[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("fake: unterminated comment")
+			}
+			i += end + 4
+		case c == '-' && i+1 < len(q) && q[i+1] == '-':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+		case c == '`':
+			end := strings.IndexByte(q[i+1:], '`')
+			if end < 0 {
+				return nil, errors.New("fake: unterminated quoted identifier")
+			}
+			toks = append(toks, fakeTok{kind: _fakeTokQuoted, s: q[i+1 : i+1+end], pos: i, end: i + end + 2})
+			i += end + 2
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(q); j++ {
+				if q[j] == '\\' && j+1 < len(q) {
+					j++
+					sb.WriteByte(q[j])
+				} else if q[j] == c {
+					if j+1 < len(q) && q[j+1] == c {
+						sb.WriteByte(c)
+						j++
+					} else {
+						break
+					}
+				} else {
+					sb.WriteByte(q[j])
+				}
+			}
+			if j >= len(q) {
+				return nil, errors.New("fake: unterminated string")
+			}
+			toks = append(toks, fakeTok{kind: _fakeTokString, s: sb.String(), pos: i, end: j + 1})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+			j := i
+			for j < len(q) && (q[j] >= '0' && q[j] <= '9' || q[j] == '.' || q[j] == 'e' || q[j] == 'E') {
+				j++
+			}
+			toks = append(toks, fakeTok{kind: _fakeTokNumber, s: q[i:j], pos: i, end: j})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+			j := i
+			for j < len(q) && (q[j] == '_' || q[j] == '$' || q[j] >= 'a' && q[j] <= 'z' || q[j] >= 'A' && q[j] <= 'Z' || q[j] >= '0' && q[j] <= '9' || q[j] >= 0x80) {
+				j++
+			}
+			toks = append(toks, fakeTok{kind: _fakeTokIdent, s: q[i:j], pos: i, end: j})
+			i = j
+		case c == '?':
+			toks = append(toks, fakeTok{kind: _fakeTokParam, s: "?", pos: i, end: i + 1})
+			i++
+		default:
+			if i+1 < len(q) {
+				switch q[i : i+2] {
+				case "<=", ">=", "<>", "!=", "||", "&&":
+					toks = append(toks, fakeTok{kind: _fakeTokSym, s: q[i : i+2], pos: i, end: i + 2})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("(),.=<>+-*/%;", rune(c)) {
+				return nil, fmt.Errorf("fake: unexpected character %q", c)
+			}
+			toks = append(toks, fakeTok{kind: _fakeTokSym, s: string(c), pos: i, end: i + 1})
+			i++
+		}
+	}
+	return append(toks, fakeTok{kind: _fakeTokEOF, pos: len(q), end: len(q)}), nil
+}
+
+/*
+   Parser
+*/
+
+var _fakeReserved = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "having": true, "order": true,
+	"limit": true, "offset": true, "and": true, "or": true, "not": true, "in": true, "is": true,
+	"like": true, "between": true, "as": true, "on": true, "join": true, "inner": true,
+	"left": true, "right": true, "cross": true, "outer": true, "union": true, "for": true,
+	"null": true, "true": true, "false": true, "exists": true, "case": true, "when": true,
+	"then": true, "else": true, "end": true, "distinct": true, "asc": true, "desc": true,
+	"set": true, "force": true, "use": true, "ignore": true, "lock": true, "into": true,
+	"values": true, "with": true, "escape": true,
+}
+
+type fakeParser struct {
+	q    string
+	toks []fakeTok
+	i    int
+	args []driver.NamedValue
+	argi int
+}
+
+func parseFakeSQL(q string, args []driver.NamedValue) (interface{}, error) {
+	toks, err := fakeTokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &fakeParser{q: q, toks: toks, args: args}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(";")
+	if p.peek().kind != _fakeTokEOF {
+		return nil, p.errorf("unexpected %q", p.peek().s)
+	}
+	if p.argi != len(args) {
+		return nil, fmt.Errorf("fake: sql expects %d args, got %d", p.argi, len(args))
+	}
+	return stmt, nil
+}
+
+func (p *fakeParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("fake: syntax error near offset %d in %q: %s", p.peek().pos, p.q, fmt.Sprintf(format, a...))
+}
+
+func (p *fakeParser) peek() fakeTok { return p.toks[p.i] }
+func (p *fakeParser) peekAt(n int) fakeTok {
+	if p.i+n < len(p.toks) {
+		return p.toks[p.i+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+func (p *fakeParser) next() fakeTok {
+	t := p.toks[p.i]
+	if t.kind != _fakeTokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the next token is the keyword or symbol s
+func (p *fakeParser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == _fakeTokIdent || t.kind == _fakeTokSym) && strings.EqualFold(t.s, s)
+}
+
+func (p *fakeParser) accept(words ...string) bool {
+	for n, w := range words {
+		t := p.peekAt(n)
+		if !((t.kind == _fakeTokIdent || t.kind == _fakeTokSym) && strings.EqualFold(t.s, w)) {
+			return false
+		}
+	}
+	p.i += len(words)
+	return true
+}
+
+func (p *fakeParser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return p.errorf("expected %q", strings.Join(words, " "))
+	}
+	return nil
+}
+
+func (p *fakeParser) ident() (string, error) {
+	t := p.peek()
+	if t.kind == _fakeTokQuoted || t.kind == _fakeTokIdent && !_fakeReserved[strings.ToLower(t.s)] {
+		p.i++
+		return strings.ToLower(t.s), nil
+	}
+	return "", p.errorf("expected identifier")
+}
+
+// tableName parses `name` or `schema`.`name`, keeping the last part
+func (p *fakeParser) tableName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.accept(".") {
+		if name, err = p.ident(); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// alias parses an optional `[as] alias`
+func (p *fakeParser) alias() string {
+	if p.accept("as") {
+		if t := p.peek(); t.kind == _fakeTokString {
+			p.i++
+			return t.s
+		}
+		name, _ := p.ident()
+		return name
+	}
+	if t := p.peek(); t.kind == _fakeTokQuoted || t.kind == _fakeTokIdent && !_fakeReserved[strings.ToLower(t.s)] {
+		p.i++
+		return strings.ToLower(t.s)
+	}
+	return ""
+}
+
+func (p *fakeParser) statement() (interface{}, error) {
+	switch {
+	case p.is("with"):
+		return p.withStmt()
+	case p.is("select") || p.is("("):
+		return p.selectStmt()
+	case p.is("insert") || p.is("replace"):
+		return p.insertStmt()
+	case p.is("update"):
+		return p.updateStmt()
+	case p.is("delete"):
+		return p.deleteStmt()
+	case p.is("create"):
+		return p.createStmt()
+	case p.is("drop"):
+		return p.dropStmt()
+	case p.is("truncate"):
+		p.next()
+		p.accept("table")
+		name, err := p.tableName()
+		return &fakeDelete{Table: name}, err
+	}
+	return nil, p.errorf("unsupported statement")
+}
+
+type fakeCTE struct {
+	Name string
+	Cols []string
+	Sel  *fakeSelect
+}
+
+type fakeWith struct {
+	Recursive bool
+	CTEs      []fakeCTE
+	Stmt      interface{}
+}
+
+func (p *fakeParser) withStmt() (*fakeWith, error) {
+	p.next()
+	w := &fakeWith{Recursive: p.accept("recursive")}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		cte := fakeCTE{Name: strings.ToLower(name)}
+		if p.accept("(") {
+			for {
+				col, err := p.ident()
+				if err != nil {
+					return nil, err
+				}
+				cte.Cols = append(cte.Cols, strings.ToLower(col))
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("as"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if cte.Sel, err = p.selectStmt(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		w.CTEs = append(w.CTEs, cte)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if !p.is("select") && !p.is("(") && !p.is("update") && !p.is("delete") {
+		return nil, p.errorf("expected select, update or delete")
+	}
+	stmt, err := p.statement()
+	w.Stmt = stmt
+	return w, err
+}
+
+type fakeSelItem struct {
+	Expr  fakeExpr
+	Alias string
+	Star  string // "*" or "alias.*"
+	Text  string
+}
+
+type fakeSource struct {
+	Table string
+	Alias string
+	Sub   *fakeSelect
+	Join  string // "", "inner", "left", "cross"
+	On    fakeExpr
+}
+
+type fakeOrder struct {
+	Expr fakeExpr
+	Desc bool
+}
+
+type fakeSelect struct {
+	Distinct bool
+	Items    []fakeSelItem
+	From     []fakeSource
+	Where    fakeExpr
+	GroupBy  []fakeExpr
+	Having   fakeExpr
+	OrderBy  []fakeOrder
+	Limit    fakeExpr
+	Offset   fakeExpr
+
+	// a union of Compound when set, UnionAll[i] tells how Compound[i+1] is added
+	Compound []*fakeSelect
+	UnionAll []bool
+}
+
+// selectStmt parses a select or a union of selects, an order by or limit after the
+// last unparenthesized part is taken as part of it rather than of the whole union
+func (p *fakeParser) selectStmt() (*fakeSelect, error) {
+	sel, err := p.selectPart()
+	if err != nil || !p.is("union") {
+		return sel, err
+	}
+	u := &fakeSelect{Compound: []*fakeSelect{sel}}
+	for p.accept("union") {
+		all := p.accept("all")
+		if !all {
+			p.accept("distinct")
+		}
+		part, err := p.selectPart()
+		if err != nil {
+			return nil, err
+		}
+		u.Compound = append(u.Compound, part)
+		u.UnionAll = append(u.UnionAll, all)
+	}
+	return u, nil
+}
+
+func (p *fakeParser) selectPart() (*fakeSelect, error) {
+	if p.accept("(") {
+		sel, err := p.selectStmt()
+		if err != nil {
+			return nil, err
+		}
+		return sel, p.expect(")")
+	}
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	sel := &fakeSelect{}
+	sel.Distinct = p.accept("distinct")
+	p.accept("all")
+	for {
+		start := p.peek().pos
+		if p.accept("*") {
+			sel.Items = append(sel.Items, fakeSelItem{Star: "*"})
+		} else if p.peekAt(1).s == "." && p.peekAt(2).s == "*" && p.peekAt(2).kind == _fakeTokSym {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			p.i += 2
+			sel.Items = append(sel.Items, fakeSelItem{Star: name + ".*"})
+		} else {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			text := strings.TrimSpace(p.q[start:p.toks[p.i-1].end])
+			if c, ok := e.(*fakeColRef); ok {
+				text = c.Name
+			}
+			sel.Items = append(sel.Items, fakeSelItem{Expr: e, Alias: p.alias(), Text: text})
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("from") {
+		if err := p.sources(sel); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if p.accept("where") {
+		if sel.Where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group", "by") {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			sel.GroupBy = append(sel.GroupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("having") {
+		if sel.Having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.OrderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	if sel.Limit, sel.Offset, err = p.limit(); err != nil {
+		return nil, err
+	}
+	// locking clauses have no effect on a single-process store
+	if p.accept("for", "update") || p.accept("for", "share") {
+		p.accept("nowait")
+		p.accept("skip", "locked")
+	}
+	p.accept("lock", "in", "share", "mode")
+	return sel, nil
+}
+
+func (p *fakeParser) sources(sel *fakeSelect) error {
+	join := ""
+	for {
+		src := fakeSource{Join: join}
+		if p.accept("(") {
+			sub, err := p.selectStmt()
+			if err != nil {
+				return err
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			src.Sub = sub
+		} else {
+			name, err := p.tableName()
+			if err != nil {
+				return err
+			}
+			src.Table = name
+		}
+		src.Alias = p.alias()
+		if src.Alias == "" {
+			src.Alias = src.Table
+		}
+		p.indexHints()
+		if join != "" && join != "cross" && p.accept("on") {
+			on, err := p.expr()
+			if err != nil {
+				return err
+			}
+			src.On = on
+		}
+		sel.From = append(sel.From, src)
+
+		switch {
+		case p.accept(","), p.accept("cross", "join"):
+			join = "cross"
+		case p.accept("join"), p.accept("inner", "join"):
+			join = "inner"
+		case p.accept("left", "join"), p.accept("left", "outer", "join"):
+			join = "left"
+		case p.is("right"):
+			return p.errorf("right join is not supported")
+		default:
+			return nil
+		}
+	}
+}
+
+// indexHints skips `force/use/ignore index (...)` hints
+func (p *fakeParser) indexHints() {
+	for p.is("force") || p.is("use") || p.is("ignore") {
+		if !p.peekAt(1).isWord("index") && !p.peekAt(1).isWord("key") {
+			return
+		}
+		p.i += 2
+		if p.accept("for") {
+			p.accept("join")
+			p.accept("order", "by")
+			p.accept("group", "by")
+		}
+		if p.accept("(") {
+			for !p.accept(")") && p.peek().kind != _fakeTokEOF {
+				p.next()
+			}
+		}
+	}
+}
+
+func (t fakeTok) isWord(s string) bool {
+	return t.kind == _fakeTokIdent && strings.EqualFold(t.s, s)
+}
+
+func (p *fakeParser) orderBy() ([]fakeOrder, error) {
+	var orders []fakeOrder
+	if p.accept("order", "by") {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			o := fakeOrder{Expr: e}
+			if p.accept("desc") {
+				o.Desc = true
+			} else {
+				p.accept("asc")
+			}
+			orders = append(orders, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return orders, nil
+}
+
+func (p *fakeParser) limit() (limit, offset fakeExpr, err error) {
+	if !p.accept("limit") {
+		return nil, nil, nil
+	}
+	if limit, err = p.primary(); err != nil {
+		return
+	}
+	if p.accept(",") {
+		offset = limit
+		limit, err = p.primary()
+	} else if p.accept("offset") {
+		offset, err = p.primary()
+	}
+	return
+}
+
+type fakeAssign struct {
+	Col  string
+	Expr fakeExpr
+}
+
+type fakeInsert struct {
+	Replace   bool
+	Ignore    bool
+	Table     string
+	Cols      []string
+	Rows      [][]fakeExpr
+	OnDup     []fakeAssign
+	Returning []string
+}
+
+func (p *fakeParser) insertStmt() (*fakeInsert, error) {
+	ins := &fakeInsert{}
+	if p.accept("replace") {
+		ins.Replace = true
+	} else {
+		p.next()
+		ins.Ignore = p.accept("ignore")
+	}
+	p.accept("into")
+	name, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	ins.Table = name
+	if p.accept("(") {
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			ins.Cols = append(ins.Cols, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept("values") && !p.accept("value") {
+		return nil, p.errorf("expected values")
+	}
+	for {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var row []fakeExpr
+		if !p.is(")") {
+			for {
+				if p.accept("default") {
+					row = append(row, nil) // keeps the column default
+					if !p.accept(",") {
+						break
+					}
+					continue
+				}
+				e, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, e)
+				if !p.accept(",") {
+					break
+				}
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		ins.Rows = append(ins.Rows, row)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if p.accept("on", "duplicate", "key", "update") {
+		if ins.OnDup, err = p.assigns(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("returning") {
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			ins.Returning = append(ins.Returning, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return ins, nil
+}
+
+func (p *fakeParser) assigns() ([]fakeAssign, error) {
+	var as []fakeAssign
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		for p.accept(".") {
+			if col, err = p.ident(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, fakeAssign{Col: col, Expr: e})
+		if !p.accept(",") {
+			return as, nil
+		}
+	}
+}
+
+type fakeUpdate struct {
+	Table   string
+	Alias   string
+	Sets    []fakeAssign
+	Where   fakeExpr
+	OrderBy []fakeOrder
+	Limit   fakeExpr
+}
+
+func (p *fakeParser) updateStmt() (*fakeUpdate, error) {
+	p.next()
+	name, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	upd := &fakeUpdate{Table: name, Alias: p.alias()}
+	p.indexHints()
+	if err := p.expect("set"); err != nil {
+		return nil, err
+	}
+	if upd.Sets, err = p.assigns(); err != nil {
+		return nil, err
+	}
+	if p.accept("where") {
+		if upd.Where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if upd.OrderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	var offset fakeExpr
+	if upd.Limit, offset, err = p.limit(); err == nil && offset != nil {
+		err = p.errorf("offset is not allowed in update")
+	}
+	return upd, err
+}
+
+type fakeDelete struct {
+	Table   string
+	Alias   string
+	Where   fakeExpr
+	OrderBy []fakeOrder
+	Limit   fakeExpr
+}
+
+func (p *fakeParser) deleteStmt() (*fakeDelete, error) {
+	p.next()
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	name, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	del := &fakeDelete{Table: name, Alias: p.alias()}
+	if p.accept("where") {
+		if del.Where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if del.OrderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	var offset fakeExpr
+	if del.Limit, offset, err = p.limit(); err == nil && offset != nil {
+		err = p.errorf("offset is not allowed in delete")
+	}
+	return del, err
+}
+
+type fakeCreate struct {
+	Table       *fakeTable
+	IfNotExists bool
+}
+
+func (p *fakeParser) createStmt() (*fakeCreate, error) {
+	p.next()
+	p.accept("temporary")
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	cr := &fakeCreate{IfNotExists: p.accept("if", "not", "exists")}
+	name, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	t := &fakeTable{Name: name}
+	cr.Table = t
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("primary", "key"):
+			key, err := p.keyCols()
+			if err != nil {
+				return nil, err
+			}
+			t.Keys = append([][]string{key}, t.Keys...)
+			t.hasPK = true
+		case p.accept("unique"):
+			if !p.accept("key") {
+				p.accept("index")
+			}
+			if !p.is("(") {
+				p.next()
+			}
+			key, err := p.keyCols()
+			if err != nil {
+				return nil, err
+			}
+			t.Keys = append(t.Keys, key)
+		case p.is("key") || p.is("index"):
+			p.next()
+			if !p.is("(") {
+				p.next()
+			}
+			if _, err := p.keyCols(); err != nil {
+				return nil, err
+			}
+		default:
+			c, pk, unique, err := p.columnDef()
+			if err != nil {
+				return nil, err
+			}
+			t.Cols = append(t.Cols, c)
+			if pk {
+				t.Keys = append([][]string{{c.Name}}, t.Keys...)
+				t.hasPK = true
+			}
+			if unique {
+				t.Keys = append(t.Keys, []string{c.Name})
+			}
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	// table options (engine, charset...) are ignored
+	for p.peek().kind != _fakeTokEOF && !p.is(";") {
+		p.next()
+	}
+	return cr, nil
+}
+
+func (p *fakeParser) keyCols() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var cols []string
+	for {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+		if p.accept("(") { // prefix length
+			p.next()
+			p.accept(")")
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	return cols, p.expect(")")
+}
+
+func (p *fakeParser) columnDef() (c *fakeColumn, pk, unique bool, err error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, false, false, err
+	}
+	c = &fakeColumn{Name: name}
+	typ := strings.ToLower(p.next().s)
+	switch {
+	case strings.Contains(typ, "int") || typ == "bit" || typ == "bool" || typ == "boolean":
+		c.Kind = _fakeInt
+	case typ == "float" || typ == "double" || typ == "real" || typ == "decimal" || typ == "numeric":
+		c.Kind = _fakeFloat
+	case strings.Contains(typ, "char") || strings.Contains(typ, "text") || typ == "enum" || typ == "set" || typ == "json":
+		c.Kind = _fakeString
+	case typ == "datetime" || typ == "timestamp" || typ == "date":
+		c.Kind = _fakeTime
+	}
+	if p.accept("(") {
+		for !p.accept(")") && p.peek().kind != _fakeTokEOF {
+			p.next()
+		}
+	}
+	for {
+		switch {
+		case p.accept("unsigned"):
+			if c.Kind == _fakeInt {
+				c.Kind = _fakeUint
+			}
+		case p.accept("not", "null"):
+			c.NotNull = true
+		case p.accept("null"), p.accept("signed"), p.accept("zerofill"):
+		case p.accept("auto_increment"), p.accept("autoincrement"):
+			c.AutoInc = true
+		case p.accept("primary", "key"):
+			pk = true
+		case p.accept("unique"):
+			p.accept("key")
+			unique = true
+		case p.accept("default"):
+			if c.Default, err = p.primary(); err != nil {
+				return
+			}
+		case p.accept("on", "update"):
+			if _, err = p.primary(); err != nil {
+				return
+			}
+		case p.accept("comment"), p.accept("collate"):
+			p.next()
+		case p.accept("character", "set"), p.accept("charset"):
+			p.next()
+		default:
+			return c, pk, unique, nil
+		}
+	}
+}
+
+type fakeDrop struct {
+	Table    string
+	IfExists bool
+}
+
+func (p *fakeParser) dropStmt() (*fakeDrop, error) {
+	p.next()
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	d := &fakeDrop{IfExists: p.accept("if", "exists")}
+	name, err := p.tableName()
+	d.Table = name
+	return d, err
+}
+
+/*
+   Expressions
+*/
+
+type fakeExpr interface {
+	eval(env *fakeEnv) (driver.Value, error)
+	children() []fakeExpr
+}
+
+func (p *fakeParser) expr() (fakeExpr, error) { return p.orExpr() }
+
+func (p *fakeParser) orExpr() (fakeExpr, error) {
+	l, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") || p.accept("||") {
+		r, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{Op: "or", L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) andExpr() (fakeExpr, error) {
+	l, err := p.notExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") || p.accept("&&") {
+		r, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{Op: "and", L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) notExpr() (fakeExpr, error) {
+	if p.is("not") && !p.peekAt(1).isWord("exists") {
+		p.next()
+		e, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeNot{E: e}, nil
+	}
+	return p.predicate()
+}
+
+func (p *fakeParser) predicate() (fakeExpr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if t := p.peek(); t.kind == _fakeTokSym {
+			switch t.s {
+			case "=", "<>", "!=", "<", "<=", ">", ">=":
+				p.next()
+				r, err := p.additive()
+				if err != nil {
+					return nil, err
+				}
+				op := t.s
+				if op == "!=" {
+					op = "<>"
+				}
+				l = &fakeBinary{Op: op, L: l, R: r}
+				continue
+			}
+		}
+		if p.accept("is") {
+			not := p.accept("not")
+			if err := p.expect("null"); err != nil {
+				return nil, err
+			}
+			l = &fakeIsNull{E: l, Not: not}
+			continue
+		}
+		not := false
+		if p.is("not") && (p.peekAt(1).isWord("in") || p.peekAt(1).isWord("like") || p.peekAt(1).isWord("between")) {
+			p.next()
+			not = true
+		}
+		switch {
+		case p.accept("in"):
+			in, err := p.inList(l, not)
+			if err != nil {
+				return nil, err
+			}
+			l = in
+		case p.accept("like"):
+			r, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			l = &fakeLike{E: l, Pattern: r, Not: not}
+		case p.accept("between"):
+			lo, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("and"); err != nil {
+				return nil, err
+			}
+			hi, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			l = &fakeBetween{E: l, Lo: lo, Hi: hi, Not: not}
+		default:
+			return l, nil
+		}
+	}
+}
+
+func (p *fakeParser) inList(l fakeExpr, not bool) (fakeExpr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	in := &fakeIn{E: l, Not: not}
+	if p.is("select") {
+		sub, err := p.selectStmt()
+		if err != nil {
+			return nil, err
+		}
+		in.Sub = sub
+	} else {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return in, p.expect(")")
+}
+
+func (p *fakeParser) additive() (fakeExpr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.next().s
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{Op: op, L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) multiplicative() (fakeExpr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") || p.is("div") || p.is("mod") {
+		op := strings.ToLower(p.next().s)
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &fakeBinary{Op: op, L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *fakeParser) unary() (fakeExpr, error) {
+	if p.accept("-") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &fakeBinary{Op: "-", L: &fakeLit{V: int64(0)}, R: e}, nil
+	}
+	p.accept("+")
+	return p.primary()
+}
+
+func (p *fakeParser) primary() (fakeExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case _fakeTokParam:
+		p.next()
+		if p.argi >= len(p.args) {
+			return nil, fmt.Errorf("fake: sql expects more than %d args", len(p.args))
+		}
+		v := p.args[p.argi].Value
+		p.argi++
+		return &fakeLit{V: v}, nil
+	case _fakeTokString:
+		p.next()
+		return &fakeLit{V: t.s}, nil
+	case _fakeTokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.s, 10, 64); err == nil {
+			return &fakeLit{V: i}, nil
+		}
+		if u, err := strconv.ParseUint(t.s, 10, 64); err == nil {
+			return &fakeLit{V: u}, nil
+		}
+		f, err := strconv.ParseFloat(t.s, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", t.s)
+		}
+		return &fakeLit{V: f}, nil
+	case _fakeTokSym:
+		if t.s == "(" {
+			p.next()
+			if p.is("select") {
+				sub, err := p.selectStmt()
+				if err != nil {
+					return nil, err
+				}
+				return &fakeScalar{Sub: sub}, p.expect(")")
+			}
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if p.accept(",") {
+				row := &fakeRow{List: []fakeExpr{e}}
+				for {
+					e, err := p.expr()
+					if err != nil {
+						return nil, err
+					}
+					row.List = append(row.List, e)
+					if !p.accept(",") {
+						break
+					}
+				}
+				return row, p.expect(")")
+			}
+			return e, p.expect(")")
+		}
+	case _fakeTokIdent, _fakeTokQuoted:
+		lower := strings.ToLower(t.s)
+		if t.kind == _fakeTokIdent {
+			switch lower {
+			case "null":
+				p.next()
+				return &fakeLit{}, nil
+			case "true":
+				p.next()
+				return &fakeLit{V: int64(1)}, nil
+			case "false":
+				p.next()
+				return &fakeLit{V: int64(0)}, nil
+			case "exists":
+				p.next()
+				if err := p.expect("("); err != nil {
+					return nil, err
+				}
+				sub, err := p.selectStmt()
+				if err != nil {
+					return nil, err
+				}
+				return &fakeExists{Sub: sub}, p.expect(")")
+			case "not":
+				if p.peekAt(1).isWord("exists") {
+					p.next()
+					e, err := p.primary()
+					if err != nil {
+						return nil, err
+					}
+					return &fakeNot{E: e}, nil
+				}
+			case "case":
+				return p.caseExpr()
+			case "current_timestamp", "now", "current_date":
+				if p.peekAt(1).s != "(" {
+					p.next()
+					return &fakeFunc{Name: "now"}, nil
+				}
+			}
+			if p.peekAt(1).s == "(" && p.peekAt(1).kind == _fakeTokSym {
+				return p.funcCall(lower)
+			}
+		}
+		if t.kind == _fakeTokIdent && _fakeReserved[lower] {
+			return nil, p.errorf("unexpected %q", t.s)
+		}
+		p.next()
+		col := &fakeColRef{Name: lower}
+		if p.is(".") {
+			p.next()
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			col.Table, col.Name = col.Name, name
+		}
+		return col, nil
+	}
+	return nil, p.errorf("unexpected %q", t.s)
+}
+
+func (p *fakeParser) funcCall(name string) (fakeExpr, error) {
+	p.i += 2
+	f := &fakeFunc{Name: name}
+	if p.accept(")") {
+		return f, nil
+	}
+	if p.accept("*") {
+		f.Star = true
+		return f, p.expect(")")
+	}
+	f.Distinct = p.accept("distinct")
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		f.Args = append(f.Args, e)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return f, p.expect(")")
+}
+
+func (p *fakeParser) caseExpr() (fakeExpr, error) {
+	p.next()
+	c := &fakeCase{}
+	var err error
+	if !p.is("when") {
+		if c.Operand, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.accept("when") {
+		w, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		th, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, [2]fakeExpr{w, th})
+	}
+	if p.accept("else") {
+		if c.Else, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, p.expect("end")
+}
+
+/*
+   Evaluation
+*/
+
+type fakeBound struct {
+	Alias string
+	Table *fakeTable
+	Cols  []string // for derived tables
+	Row   map[string]driver.Value
+}
+
+func (b *fakeBound) has(col string) bool {
+	if b.Table != nil {
+		return b.Table.col(col) != nil
+	}
+	for _, c := range b.Cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeEnv struct {
+	state   *fakeState
+	srcs    []fakeBound
+	group   []*fakeEnv // rows of the current group, nil when not aggregating
+	aliases map[string]driver.Value
+	values  map[string]driver.Value // VALUES(col) of on duplicate key update
+	outer   *fakeEnv
+}
+
+type fakeLit struct {
+	V driver.Value
+}
+
+func (e *fakeLit) eval(env *fakeEnv) (driver.Value, error) { return e.V, nil }
+func (e *fakeLit) children() []fakeExpr                    { return nil }
+
+type fakeColRef struct {
+	Table string
+	Name  string
+}
+
+func (e *fakeColRef) children() []fakeExpr { return nil }
+
+func (e *fakeColRef) eval(env *fakeEnv) (driver.Value, error) {
+	for x := env; x != nil; x = x.outer {
+		found := -1
+		for i := range x.srcs {
+			if (e.Table == "" || e.Table == x.srcs[i].Alias) && x.srcs[i].has(e.Name) {
+				if found >= 0 && e.Table == "" {
+					return nil, fmt.Errorf("fake: column '%s' is ambiguous", e.Name)
+				}
+				found = i
+			}
+		}
+		if found >= 0 {
+			if x.srcs[found].Row == nil {
+				return nil, nil
+			}
+			return x.srcs[found].Row[e.Name], nil
+		}
+		if e.Table == "" && x.aliases != nil {
+			if v, ok := x.aliases[e.Name]; ok {
+				return v, nil
+			}
+		}
+	}
+	name := e.Name
+	if e.Table != "" {
+		name = e.Table + "." + e.Name
+	}
+	return nil, fmt.Errorf("fake: unknown column '%s'", name)
+}
+
+type fakeBinary struct {
+	Op   string
+	L, R fakeExpr
+}
+
+func (e *fakeBinary) children() []fakeExpr { return []fakeExpr{e.L, e.R} }
+
+func (e *fakeBinary) eval(env *fakeEnv) (driver.Value, error) {
+	l, err := e.L.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "and":
+		if l != nil && !fakeTruth(l) {
+			return int64(0), nil
+		}
+		r, err := e.R.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && !fakeTruth(r) {
+			return int64(0), nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return int64(1), nil
+	case "or":
+		if l != nil && fakeTruth(l) {
+			return int64(1), nil
+		}
+		r, err := e.R.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && fakeTruth(r) {
+			return int64(1), nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return int64(0), nil
+	}
+	r, err := e.R.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if lr, ok := e.L.(*fakeRow); ok {
+		if rr, ok := e.R.(*fakeRow); ok && (e.Op == "=" || e.Op == "<>") {
+			eq, err := fakeRowEqual(env, lr, rr)
+			if err != nil || eq == nil {
+				return nil, err
+			}
+			if e.Op == "<>" {
+				return fakeBool(!fakeTruth(eq)), nil
+			}
+			return eq, nil
+		}
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch e.Op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		c, _ := fakeCompare(l, r)
+		switch e.Op {
+		case "=":
+			return fakeBool(c == 0), nil
+		case "<>":
+			return fakeBool(c != 0), nil
+		case "<":
+			return fakeBool(c < 0), nil
+		case "<=":
+			return fakeBool(c <= 0), nil
+		case ">":
+			return fakeBool(c > 0), nil
+		default:
+			return fakeBool(c >= 0), nil
+		}
+	}
+	return fakeArith(e.Op, l, r)
+}
+
+type fakeNot struct {
+	E fakeExpr
+}
+
+func (e *fakeNot) children() []fakeExpr { return []fakeExpr{e.E} }
+
+func (e *fakeNot) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := e.E.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return fakeBool(!fakeTruth(v)), nil
+}
+
+type fakeIsNull struct {
+	E   fakeExpr
+	Not bool
+}
+
+func (e *fakeIsNull) children() []fakeExpr { return []fakeExpr{e.E} }
+
+func (e *fakeIsNull) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := e.E.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return fakeBool((v == nil) != e.Not), nil
+}
+
+// fakeRow is a row constructor such as (a,b)
+type fakeRow struct {
+	List []fakeExpr
+}
+
+func (e *fakeRow) children() []fakeExpr { return e.List }
+
+func (e *fakeRow) eval(env *fakeEnv) (driver.Value, error) {
+	return nil, errors.New("fake: operand should contain 1 column")
+}
+
+func (e *fakeRow) values(env *fakeEnv) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(e.List))
+	for i, x := range e.List {
+		v, err := x.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func fakeRowEqual(env *fakeEnv, l, r *fakeRow) (driver.Value, error) {
+	if len(l.List) != len(r.List) {
+		return nil, fmt.Errorf("fake: operand should contain %d columns", len(l.List))
+	}
+	lv, err := l.values(env)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := r.values(env)
+	if err != nil {
+		return nil, err
+	}
+	return fakeTupleEqual(lv, rv), nil
+}
+
+func fakeTupleEqual(l, r []driver.Value) driver.Value {
+	unknown := false
+	for i := range l {
+		if l[i] == nil || r[i] == nil {
+			unknown = true
+			continue
+		}
+		if c, _ := fakeCompare(l[i], r[i]); c != 0 {
+			return int64(0)
+		}
+	}
+	if unknown {
+		return nil
+	}
+	return int64(1)
+}
+
+type fakeIn struct {
+	E    fakeExpr
+	List []fakeExpr
+	Sub  *fakeSelect
+	Not  bool
+}
+
+func (e *fakeIn) children() []fakeExpr { return append([]fakeExpr{e.E}, e.List...) }
+
+func (e *fakeIn) eval(env *fakeEnv) (driver.Value, error) {
+	var left []driver.Value
+	if row, ok := e.E.(*fakeRow); ok {
+		vals, err := row.values(env)
+		if err != nil {
+			return nil, err
+		}
+		left = vals
+	} else {
+		v, err := e.E.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		left = []driver.Value{v}
+	}
+
+	var candidates [][]driver.Value
+	if e.Sub != nil {
+		_, data, err := e.Sub.run(env.state, env)
+		if err != nil {
+			return nil, err
+		}
+		candidates = data
+	} else {
+		for _, x := range e.List {
+			if row, ok := x.(*fakeRow); ok {
+				vals, err := row.values(env)
+				if err != nil {
+					return nil, err
+				}
+				candidates = append(candidates, vals)
+				continue
+			}
+			v, err := x.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, []driver.Value{v})
+		}
+	}
+
+	unknown := false
+	for _, c := range candidates {
+		if len(c) != len(left) {
+			return nil, fmt.Errorf("fake: operand should contain %d column(s)", len(left))
+		}
+		eq := fakeTupleEqual(left, c)
+		if eq == nil {
+			unknown = true
+		} else if fakeTruth(eq) {
+			return fakeBool(!e.Not), nil
+		}
+	}
+	if unknown {
+		return nil, nil
+	}
+	return fakeBool(e.Not), nil
+}
+
+type fakeBetween struct {
+	E, Lo, Hi fakeExpr
+	Not       bool
+}
+
+func (e *fakeBetween) children() []fakeExpr { return []fakeExpr{e.E, e.Lo, e.Hi} }
+
+func (e *fakeBetween) eval(env *fakeEnv) (driver.Value, error) {
+	var vals [3]driver.Value
+	for i, x := range []fakeExpr{e.E, e.Lo, e.Hi} {
+		v, err := x.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, nil
+		}
+		vals[i] = v
+	}
+	lo, _ := fakeCompare(vals[0], vals[1])
+	hi, _ := fakeCompare(vals[0], vals[2])
+	return fakeBool((lo >= 0 && hi <= 0) != e.Not), nil
+}
+
+type fakeLike struct {
+	E, Pattern fakeExpr
+	Not        bool
+}
+
+func (e *fakeLike) children() []fakeExpr { return []fakeExpr{e.E, e.Pattern} }
+
+func (e *fakeLike) eval(env *fakeEnv) (driver.Value, error) {
+	v, err := e.E.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	pat, err := e.Pattern.eval(env)
+	if err != nil || v == nil || pat == nil {
+		return nil, err
+	}
+	return fakeBool(fakeLikeMatch(fakeString(v), fakeString(pat)) != e.Not), nil
+}
+
+// fakeLikeMatch matches s against a LIKE pattern with % and _ wildcards and \ escapes
+func fakeLikeMatch(s, pat string) bool {
+	if pat == "" {
+		return s == ""
+	}
+	switch pat[0] {
+	case '%':
+		for i := 0; i <= len(s); i++ {
+			if fakeLikeMatch(s[i:], pat[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		if s == "" {
+			return false
+		}
+		_, n := decodeFakeRune(s)
+		return fakeLikeMatch(s[n:], pat[1:])
+	case '\\':
+		if len(pat) > 1 {
+			pat = pat[1:]
+		}
+	}
+	return s != "" && s[0] == pat[0] && fakeLikeMatch(s[1:], pat[1:])
+}
+
+func decodeFakeRune(s string) (rune, int) {
+	for i, r := range s {
+		if i > 0 {
+			return r, i
+		}
+	}
+	return 0, len(s)
+}
+
+type fakeExists struct {
+	Sub *fakeSelect
+}
+
+func (e *fakeExists) children() []fakeExpr { return nil }
+
+func (e *fakeExists) eval(env *fakeEnv) (driver.Value, error) {
+	_, data, err := e.Sub.run(env.state, env)
+	if err != nil {
+		return nil, err
+	}
+	return fakeBool(len(data) > 0), nil
+}
+
+type fakeScalar struct {
+	Sub *fakeSelect
+}
+
+func (e *fakeScalar) children() []fakeExpr { return nil }
+
+func (e *fakeScalar) eval(env *fakeEnv) (driver.Value, error) {
+	cols, data, err := e.Sub.run(env.state, env)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) != 1 {
+		return nil, errors.New("fake: operand should contain 1 column")
+	}
+	switch len(data) {
+	case 0:
+		return nil, nil
+	case 1:
+		return data[0][0], nil
+	}
+	return nil, errors.New("fake: subquery returns more than 1 row")
+}
+
+type fakeCase struct {
+	Operand fakeExpr
+	Whens   [][2]fakeExpr
+	Else    fakeExpr
+}
+
+func (e *fakeCase) children() []fakeExpr {
+	c := []fakeExpr{}
+	if e.Operand != nil {
+		c = append(c, e.Operand)
+	}
+	for _, w := range e.Whens {
+		c = append(c, w[0], w[1])
+	}
+	if e.Else != nil {
+		c = append(c, e.Else)
+	}
+	return c
+}
+
+func (e *fakeCase) eval(env *fakeEnv) (driver.Value, error) {
+	var op driver.Value
+	if e.Operand != nil {
+		v, err := e.Operand.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		op = v
+	}
+	for _, w := range e.Whens {
+		v, err := w[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		hit := false
+		if e.Operand != nil {
+			c, ok := fakeCompare(op, v)
+			hit = ok && c == 0
+		} else {
+			hit = v != nil && fakeTruth(v)
+		}
+		if hit {
+			return w[1].eval(env)
+		}
+	}
+	if e.Else != nil {
+		return e.Else.eval(env)
+	}
+	return nil, nil
+}
+
+type fakeFunc struct {
+	Name     string
+	Args     []fakeExpr
+	Star     bool
+	Distinct bool
+}
+
+func (e *fakeFunc) children() []fakeExpr { return e.Args }
+
+func (e *fakeFunc) isAggregate() bool {
+	switch e.Name {
+	case "count", "sum", "avg", "min", "max", "group_concat":
+		return true
+	}
+	return false
+}
+
+func (e *fakeFunc) eval(env *fakeEnv) (driver.Value, error) {
+	if e.isAggregate() {
+		return e.aggregate(env)
+	}
+	if e.Name == "values" {
+		if c, ok := e.Args[0].(*fakeColRef); ok && len(e.Args) == 1 {
+			if env.values == nil {
+				return nil, nil
+			}
+			return env.values[c.Name], nil
+		}
+		return nil, errors.New("fake: values() expects a column")
+	}
+	args := make([]driver.Value, len(e.Args))
+	for i, a := range e.Args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch e.Name {
+	case "coalesce", "ifnull":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "if":
+		if len(args) != 3 {
+			return nil, errors.New("fake: if() expects 3 arguments")
+		}
+		if args[0] != nil && fakeTruth(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "concat":
+		var sb strings.Builder
+		for _, a := range args {
+			if a == nil {
+				return nil, nil
+			}
+			sb.WriteString(fakeString(a))
+		}
+		return sb.String(), nil
+	case "length", "octet_length":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		return int64(len(fakeString(args[0]))), nil
+	case "char_length":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		return int64(len([]rune(fakeString(args[0])))), nil
+	case "upper", "ucase":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		return strings.ToUpper(fakeString(args[0])), nil
+	case "lower", "lcase":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		return strings.ToLower(fakeString(args[0])), nil
+	case "abs":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		if c, _ := fakeCompare(args[0], int64(0)); c < 0 {
+			return fakeArith("-", int64(0), args[0])
+		}
+		return args[0], nil
+	case "now", "current_timestamp", "sysdate":
+		return time.Now().UTC().Truncate(time.Second), nil
+	case "unix_timestamp":
+		if len(args) == 0 {
+			return time.Now().Unix(), nil
+		}
+		if tm, ok := args[0].(time.Time); ok {
+			return tm.Unix(), nil
+		}
+		return nil, nil
+	case "json_extract":
+		return nil, errors.New("fake: json_extract is not supported")
+	}
+	return nil, fmt.Errorf("fake: function %s does not exist", e.Name)
+}
+
+func (e *fakeFunc) aggregate(env *fakeEnv) (driver.Value, error) {
+	if env.group == nil {
+		return nil, fmt.Errorf("fake: invalid use of group function %s", e.Name)
+	}
+	var (
+		vals []driver.Value
+		seen = map[string]bool{}
+	)
+	for _, r := range env.group {
+		if e.Star {
+			vals = append(vals, int64(1))
+			continue
+		}
+		if len(e.Args) == 0 {
+			return nil, fmt.Errorf("fake: %s expects an argument", e.Name)
+		}
+		v, err := e.Args[0].eval(r)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if e.Distinct {
+			k := fakeKey(v)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		vals = append(vals, v)
+	}
+	switch e.Name {
+	case "count":
+		return int64(len(vals)), nil
+	case "sum", "avg":
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		var sum driver.Value = int64(0)
+		for _, v := range vals {
+			s, err := fakeArith("+", sum, v)
+			if err != nil {
+				return nil, err
+			}
+			sum = s
+		}
+		if e.Name == "avg" {
+			f, _ := fakeFloat(sum)
+			return f / float64(len(vals)), nil
+		}
+		return sum, nil
+	case "min", "max":
+		var res driver.Value
+		for _, v := range vals {
+			if res == nil {
+				res = v
+				continue
+			}
+			c, _ := fakeCompare(v, res)
+			if e.Name == "min" && c < 0 || e.Name == "max" && c > 0 {
+				res = v
+			}
+		}
+		return res, nil
+	case "group_concat":
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		strs := make([]string, len(vals))
+		for i, v := range vals {
+			strs[i] = fakeString(v)
+		}
+		return strings.Join(strs, ","), nil
+	}
+	return nil, nil
+}
+
+/*
+   Value helpers
+*/
+
+func fakeBool(b bool) driver.Value {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func fakeTruth(v driver.Value) bool {
+	f, _ := fakeFloat(v)
+	return f != 0
+}
+
+func fakeString(v driver.Value) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(_timeLayout)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func fakeKey(v driver.Value) string {
+	return fmt.Sprintf("%T:%s", v, fakeString(v))
+}
+
+func fakeFloat(v driver.Value) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		return float64(x.Unix()), true
+	case string, []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(fakeString(x)), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func fakeIsText(v driver.Value) bool {
+	switch v.(type) {
+	case string, []byte:
+		return true
+	}
+	return false
+}
+
+// fakeCompare compares two non-NULL values the way MySQL would for common types
+func fakeCompare(a, b driver.Value) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if fakeIsText(a) && fakeIsText(b) {
+		return strings.Compare(fakeString(a), fakeString(b)), true
+	}
+	ta, aIsTime := a.(time.Time)
+	tb, bIsTime := b.(time.Time)
+	if aIsTime || bIsTime {
+		if !aIsTime {
+			if fakeIsText(a) {
+				t, err := parseTimeString(fakeString(a))
+				if err != nil {
+					return strings.Compare(fakeString(a), fakeString(b)), true
+				}
+				ta = t
+			} else {
+				f, _ := fakeFloat(a)
+				ta = time.Unix(int64(f), 0)
+			}
+		}
+		if !bIsTime {
+			if fakeIsText(b) {
+				t, err := parseTimeString(fakeString(b))
+				if err != nil {
+					return strings.Compare(fakeString(a), fakeString(b)), true
+				}
+				tb = t
+			} else {
+				f, _ := fakeFloat(b)
+				tb = time.Unix(int64(f), 0)
+			}
+		}
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+	// exact comparison for integers, including uint64 beyond int64
+	ia, aInt := fakeInt(a)
+	ib, bInt := fakeInt(b)
+	if aInt && bInt {
+		ua, aU := a.(uint64)
+		ub, bU := b.(uint64)
+		switch {
+		case aU && bU:
+			return fakeCmp(ua < ub, ua > ub), true
+		case aU:
+			if ib < 0 {
+				return 1, true
+			}
+			return fakeCmp(ua < uint64(ib), ua > uint64(ib)), true
+		case bU:
+			if ia < 0 {
+				return -1, true
+			}
+			return fakeCmp(uint64(ia) < ub, uint64(ia) > ub), true
+		}
+		return fakeCmp(ia < ib, ia > ib), true
+	}
+	fa, _ := fakeFloat(a)
+	fb, _ := fakeFloat(b)
+	return fakeCmp(fa < fb, fa > fb), true
+}
+
+func fakeCmp(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+func fakeInt(v driver.Value) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case uint64:
+		return int64(x), true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func fakeArith(op string, l, r driver.Value) (driver.Value, error) {
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	li, lInt := fakeInt(l)
+	ri, rInt := fakeInt(r)
+	_, lU := l.(uint64)
+	_, rU := r.(uint64)
+	if lInt && rInt && !lU && !rU {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "div", "%", "mod":
+			if ri == 0 {
+				return nil, nil
+			}
+			if op == "div" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+	lf, _ := fakeFloat(l)
+	rf, _ := fakeFloat(r)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, nil
+		}
+		return lf / rf, nil
+	case "div":
+		if rf == 0 {
+			return nil, nil
+		}
+		return int64(lf / rf), nil
+	}
+	return nil, fmt.Errorf("fake: unsupported operator %s", op)
+}
+
+func fakeWalk(e fakeExpr, f func(fakeExpr) bool) bool {
+	if e == nil {
+		return false
+	}
+	if f(e) {
+		return true
+	}
+	for _, c := range e.children() {
+		if fakeWalk(c, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeHasAggregate(e fakeExpr) bool {
+	return fakeWalk(e, func(x fakeExpr) bool {
+		f, ok := x.(*fakeFunc)
+		return ok && f.isAggregate()
+	})
+}
+
+/*
+   Execution
+*/
+
+// bind returns a state where the common table expressions are tables, other tables are shared with s
+func (w *fakeWith) bind(s *fakeState) (*fakeState, error) {
+	ws := newFakeState()
+	for k, t := range s.tables {
+		ws.tables[k] = t
+	}
+	for _, cte := range w.CTEs {
+		t := &fakeTable{Name: cte.Name}
+		ws.tables[cte.Name] = t
+
+		sel := cte.Sel
+		if !w.Recursive || sel.Compound == nil {
+			cols, data, err := sel.run(ws, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := t.fill(cte.Cols, cols, data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// the anchor part, then the recursive parts against the rows found by the previous round
+		cols, data, err := sel.Compound[0].run(ws, nil)
+		if err != nil {
+			return nil, err
+		}
+		all, seen := data, map[string]bool{}
+		for _, vals := range data {
+			seen[fakeRowKey(vals)] = true
+		}
+		for depth := 0; len(data) > 0; depth++ {
+			if depth >= 1000 {
+				return nil, fmt.Errorf("fake: recursive query aborted after 1000 iterations")
+			}
+			if err := t.fill(cte.Cols, cols, data); err != nil {
+				return nil, err
+			}
+			var next [][]driver.Value
+			for i, part := range sel.Compound[1:] {
+				_, more, err := part.run(ws, nil)
+				if err != nil {
+					return nil, err
+				}
+				for _, vals := range more {
+					if !sel.UnionAll[i] {
+						if seen[fakeRowKey(vals)] {
+							continue
+						}
+						seen[fakeRowKey(vals)] = true
+					}
+					next = append(next, vals)
+				}
+			}
+			all, data = append(all, next...), next
+		}
+		if err := t.fill(cte.Cols, cols, all); err != nil {
+			return nil, err
+		}
+	}
+	return ws, nil
+}
+
+// fill replaces the columns and rows of t with a result set
+func (t *fakeTable) fill(names, cols []string, data [][]driver.Value) error {
+	if names == nil {
+		names = make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = strings.ToLower(c)
+		}
+	} else if len(names) != len(cols) {
+		return fmt.Errorf("fake: view's SELECT and view's field list have different column counts")
+	}
+	t.Cols = nil
+	for _, n := range names {
+		t.Cols = append(t.Cols, &fakeColumn{Name: n})
+	}
+	t.rows = make([]map[string]driver.Value, len(data))
+	for i, vals := range data {
+		r := make(map[string]driver.Value, len(names))
+		for j, n := range names {
+			r[n] = vals[j]
+		}
+		t.rows[i] = r
+	}
+	return nil
+}
+
+func fakeRowKey(vals []driver.Value) string {
+	var kb strings.Builder
+	for _, v := range vals {
+		kb.WriteString(fakeKey(v))
+		kb.WriteByte(0)
+	}
+	return kb.String()
+}
+
+func execFakeStmt(s *fakeState, stmt interface{}) (driver.Result, error) {
+	switch st := stmt.(type) {
+	case *fakeWith:
+		ws, err := st.bind(s)
+		if err != nil {
+			return nil, err
+		}
+		return execFakeStmt(ws, st.Stmt)
+	case *fakeSelect:
+		_, _, err := st.run(s, nil)
+		return &fakeResult{}, err
+	case *fakeInsert:
+		return st.exec(s)
+	case *fakeUpdate:
+		return st.exec(s)
+	case *fakeDelete:
+		return st.exec(s)
+	case *fakeCreate:
+		if _, ok := s.tables[st.Table.Name]; ok {
+			if st.IfNotExists {
+				return &fakeResult{}, nil
+			}
+			return nil, fmt.Errorf("fake: table '%s' already exists", st.Table.Name)
+		}
+		s.tables[st.Table.Name] = st.Table
+		return &fakeResult{}, nil
+	case *fakeDrop:
+		if _, ok := s.tables[st.Table]; !ok && !st.IfExists {
+			return nil, fmt.Errorf("fake: unknown table '%s'", st.Table)
+		}
+		delete(s.tables, st.Table)
+		return &fakeResult{}, nil
+	}
+	return nil, errors.New("fake: unsupported statement")
+}
+
+func fakeLimit(env *fakeEnv, e fakeExpr) (int, error) {
+	if e == nil {
+		return -1, nil
+	}
+	v, err := e.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := fakeInt(v)
+	if !ok {
+		if f, ok := fakeFloat(v); ok {
+			n = int64(f)
+		} else {
+			return 0, fmt.Errorf("fake: bad limit %v", v)
+		}
+	}
+	return int(n), nil
+}
+
+// run executes the select, outer is the enclosing row for correlated subqueries
+func (sel *fakeSelect) runUnion(s *fakeState, outer *fakeEnv) ([]string, [][]driver.Value, error) {
+	cols, data, err := sel.Compound[0].run(s, outer)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, part := range sel.Compound[1:] {
+		partCols, more, err := part.run(s, outer)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(partCols) != len(cols) {
+			return nil, nil, fmt.Errorf("fake: the used SELECT statements have a different number of columns")
+		}
+		data = append(data, more...)
+		if !sel.UnionAll[i] {
+			// a distinct union removes duplicates from everything on its left
+			seen := map[string]bool{}
+			uniq := data[:0]
+			for _, vals := range data {
+				if k := fakeRowKey(vals); !seen[k] {
+					seen[k] = true
+					uniq = append(uniq, vals)
+				}
+			}
+			data = uniq
+		}
+	}
+	return cols, data, nil
+}
+
+func (sel *fakeSelect) run(s *fakeState, outer *fakeEnv) ([]string, [][]driver.Value, error) {
+	if sel.Compound != nil {
+		return sel.runUnion(s, outer)
+	}
+
+	// build the cartesian product of sources, filtered by join conditions
+	combos := [][]fakeBound{{}}
+	for _, src := range sel.From {
+		var (
+			tbl  *fakeTable
+			cols []string
+			rows []map[string]driver.Value
+		)
+		if src.Sub != nil {
+			subCols, data, err := src.Sub.run(s, outer)
+			if err != nil {
+				return nil, nil, err
+			}
+			cols = make([]string, len(subCols))
+			for i, c := range subCols {
+				cols[i] = strings.ToLower(c)
+			}
+			for _, d := range data {
+				r := make(map[string]driver.Value, len(cols))
+				for i, c := range cols {
+					r[c] = d[i]
+				}
+				rows = append(rows, r)
+			}
+		} else {
+			t, err := s.table(src.Table)
+			if err != nil {
+				return nil, nil, err
+			}
+			tbl, rows = t, t.rows
+		}
+		var next [][]fakeBound
+		for _, combo := range combos {
+			matched := false
+			for _, r := range rows {
+				c := append(append([]fakeBound(nil), combo...), fakeBound{Alias: src.Alias, Table: tbl, Cols: cols, Row: r})
+				if src.On != nil {
+					v, err := src.On.eval(&fakeEnv{state: s, srcs: c, outer: outer})
+					if err != nil {
+						return nil, nil, err
+					}
+					if v == nil || !fakeTruth(v) {
+						continue
+					}
+				}
+				matched = true
+				next = append(next, c)
+			}
+			if !matched && src.Join == "left" {
+				next = append(next, append(append([]fakeBound(nil), combo...), fakeBound{Alias: src.Alias, Table: tbl, Cols: cols}))
+			}
+		}
+		combos = next
+	}
+
+	// a NULL row for every source, used to validate expressions when there is no data
+	var nullSrcs []fakeBound
+	if len(combos) > 0 {
+		for _, b := range combos[0] {
+			nullSrcs = append(nullSrcs, fakeBound{Alias: b.Alias, Table: b.Table, Cols: b.Cols})
+		}
+	} else {
+		for _, src := range sel.From {
+			b := fakeBound{Alias: src.Alias}
+			if src.Sub == nil {
+				b.Table, _ = s.table(src.Table)
+			}
+			nullSrcs = append(nullSrcs, b)
+		}
+	}
+	nullEnv := &fakeEnv{state: s, srcs: nullSrcs, outer: outer}
+
+	var envs []*fakeEnv
+	if sel.Where != nil {
+		if _, err := sel.Where.eval(nullEnv); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, c := range combos {
+		env := &fakeEnv{state: s, srcs: c, outer: outer}
+		if sel.Where != nil {
+			v, err := sel.Where.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			if v == nil || !fakeTruth(v) {
+				continue
+			}
+		}
+		envs = append(envs, env)
+	}
+
+	// expand the projection
+	var (
+		cols  []string
+		exprs []fakeExpr
+	)
+	for _, it := range sel.Items {
+		if it.Star == "" {
+			name := it.Alias
+			if name == "" {
+				name = it.Text
+			}
+			cols = append(cols, name)
+			exprs = append(exprs, it.Expr)
+			continue
+		}
+		for _, b := range nullSrcs {
+			if it.Star != "*" && it.Star != b.Alias+".*" {
+				continue
+			}
+			names := b.Cols
+			if b.Table != nil {
+				names = nil
+				for _, c := range b.Table.Cols {
+					names = append(names, c.Name)
+				}
+			}
+			for _, n := range names {
+				cols = append(cols, n)
+				exprs = append(exprs, &fakeColRef{Table: b.Alias, Name: n})
+			}
+		}
+	}
+
+	aggregated := len(sel.GroupBy) > 0 || fakeHasAggregate(sel.Having)
+	for _, e := range exprs {
+		aggregated = aggregated || fakeHasAggregate(e)
+	}
+	for _, o := range sel.OrderBy {
+		aggregated = aggregated || fakeHasAggregate(o.Expr)
+	}
+
+	if aggregated {
+		nullEnv.group = []*fakeEnv{}
+		var groups []*fakeEnv
+		index := map[string]*fakeEnv{}
+		for _, env := range envs {
+			var kb strings.Builder
+			for _, g := range sel.GroupBy {
+				v, err := g.eval(env)
+				if err != nil {
+					return nil, nil, err
+				}
+				kb.WriteString(fakeKey(v))
+				kb.WriteByte(0)
+			}
+			k := kb.String()
+			g, ok := index[k]
+			if !ok {
+				g = &fakeEnv{state: s, srcs: env.srcs, outer: outer, group: []*fakeEnv{}}
+				index[k] = g
+				groups = append(groups, g)
+			}
+			g.group = append(g.group, env)
+		}
+		if len(groups) == 0 && len(sel.GroupBy) == 0 {
+			groups = append(groups, &fakeEnv{state: s, srcs: nullSrcs, outer: outer, group: []*fakeEnv{}})
+		}
+		envs = groups
+	}
+
+	for _, e := range exprs {
+		if _, err := e.eval(nullEnv); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	type outRow struct {
+		vals []driver.Value
+		keys []driver.Value
+	}
+	var out []outRow
+	for _, env := range envs {
+		vals := make([]driver.Value, len(exprs))
+		for i, e := range exprs {
+			v, err := e.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			vals[i] = v
+		}
+		env.aliases = make(map[string]driver.Value, len(cols))
+		for i, c := range cols {
+			env.aliases[strings.ToLower(c)] = vals[i]
+		}
+		if sel.Having != nil {
+			v, err := sel.Having.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			if v == nil || !fakeTruth(v) {
+				continue
+			}
+		}
+		r := outRow{vals: vals}
+		for _, o := range sel.OrderBy {
+			// ORDER BY 1 refers to the first projected column
+			if lit, ok := o.Expr.(*fakeLit); ok {
+				if n, ok := lit.V.(int64); ok && n >= 1 && int(n) <= len(vals) {
+					r.keys = append(r.keys, vals[n-1])
+					continue
+				}
+			}
+			v, err := o.Expr.eval(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			r.keys = append(r.keys, v)
+		}
+		out = append(out, r)
+	}
+
+	if len(sel.OrderBy) > 0 {
+		sort.SliceStable(out, func(i, j int) bool {
+			for k, o := range sel.OrderBy {
+				a, b := out[i].keys[k], out[j].keys[k]
+				var c int
+				switch {
+				case a == nil && b == nil:
+					c = 0
+				case a == nil:
+					c = -1
+				case b == nil:
+					c = 1
+				default:
+					c, _ = fakeCompare(a, b)
+				}
+				if o.Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	data := make([][]driver.Value, 0, len(out))
+	seen := map[string]bool{}
+	for _, r := range out {
+		if sel.Distinct {
+			var kb strings.Builder
+			for _, v := range r.vals {
+				kb.WriteString(fakeKey(v))
+				kb.WriteByte(0)
+			}
+			if seen[kb.String()] {
+				continue
+			}
+			seen[kb.String()] = true
+		}
+		data = append(data, r.vals)
+	}
+
+	limit, err := fakeLimit(nullEnv, sel.Limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	offset, err := fakeLimit(nullEnv, sel.Offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset > 0 {
+		if offset > len(data) {
+			offset = len(data)
+		}
+		data = data[offset:]
+	}
+	if limit >= 0 && limit < len(data) {
+		data = data[:limit]
+	}
+	return cols, data, nil
+}
+
+func (ins *fakeInsert) exec(s *fakeState) (driver.Result, error) {
+	t, err := s.table(ins.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := ins.Cols
+	if len(cols) == 0 {
+		for _, c := range t.Cols {
+			cols = append(cols, c.Name)
+		}
+	}
+	for _, c := range cols {
+		if t.col(c) == nil {
+			return nil, fmt.Errorf("fake: unknown column '%s' in 'field list'", c)
+		}
+	}
+
+	res := &fakeResult{}
+	auto := t.autoCol()
+	env := &fakeEnv{state: s}
+	for _, exprs := range ins.Rows {
+		if len(exprs) != len(cols) {
+			return nil, errors.New("fake: column count doesn't match value count")
+		}
+		row := make(map[string]driver.Value, len(t.Cols))
+		for _, c := range t.Cols {
+			if c.Default != nil {
+				v, err := c.Default.eval(env)
+				if err != nil {
+					return nil, err
+				}
+				row[c.Name] = t.coerce(c, v)
+			} else {
+				row[c.Name] = nil
+			}
+		}
+		for i, e := range exprs {
+			if e == nil {
+				continue
+			}
+			v, err := e.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			row[cols[i]] = t.coerce(t.col(cols[i]), v)
+		}
+
+		if auto != nil {
+			if id, ok := fakeInt(row[auto.Name]); ok && id != 0 {
+				if id > t.autoInc {
+					t.autoInc = id
+				}
+				if res.lastID == 0 {
+					res.lastID = id
+				}
+			} else {
+				t.autoInc++
+				row[auto.Name] = t.autoInc
+				if res.lastID == 0 {
+					res.lastID = t.autoInc
+				}
+			}
+		}
+		for _, c := range t.Cols {
+			if c.NotNull && row[c.Name] == nil && !c.AutoInc {
+				return nil, fmt.Errorf("fake: column '%s' cannot be null", c.Name)
+			}
+		}
+
+		idx, key := t.conflict(row, -1)
+		if idx < 0 {
+			t.rows = append(t.rows, row)
+			res.affected++
+			ins.returnRow(res, row)
+			continue
+		}
+		switch {
+		case ins.Replace:
+			for idx >= 0 {
+				t.rows = append(t.rows[:idx], t.rows[idx+1:]...)
+				res.affected++
+				idx, _ = t.conflict(row, -1)
+			}
+			t.rows = append(t.rows, row)
+			res.affected++
+			ins.returnRow(res, row)
+		case len(ins.OnDup) > 0:
+			old := t.rows[idx]
+			updated := copyFakeRow(old)
+			uenv := &fakeEnv{state: s, srcs: []fakeBound{{Alias: t.Name, Table: t, Row: updated}}, values: row}
+			for _, a := range ins.OnDup {
+				c := t.col(a.Col)
+				if c == nil {
+					return nil, fmt.Errorf("fake: unknown column '%s' in 'field list'", a.Col)
+				}
+				v, err := a.Expr.eval(uenv)
+				if err != nil {
+					return nil, err
+				}
+				updated[a.Col] = t.coerce(c, v)
+			}
+			if other, key := t.conflict(updated, idx); other >= 0 {
+				return nil, fmt.Errorf("fake: duplicate entry for key '%s'", key)
+			}
+			if !fakeRowsEqual(old, updated) {
+				t.rows[idx] = updated
+				res.affected += 2
+				ins.returnRow(res, updated)
+			}
+			if auto != nil {
+				res.lastID, _ = fakeInt(updated[auto.Name])
+			}
+		case ins.Ignore:
+		default:
+			return nil, fmt.Errorf("fake: duplicate entry '%s' for key '%s'", fakeKeyValue(t, row, key), key)
+		}
+	}
+	return res, nil
+}
+
+func (ins *fakeInsert) returnRow(res *fakeResult, row map[string]driver.Value) {
+	if len(ins.Returning) <= 0 {
+		return
+	}
+	vals := make([]driver.Value, len(ins.Returning))
+	for i, c := range ins.Returning {
+		vals[i] = row[c]
+	}
+	res.returning = append(res.returning, vals)
+}
+
+func fakeKeyValue(t *fakeTable, row map[string]driver.Value, key string) string {
+	cols := strings.Split(key, ",")
+	if key == "PRIMARY" {
+		cols = t.Keys[0]
+	}
+	vals := make([]string, len(cols))
+	for i, c := range cols {
+		vals[i] = fakeString(row[c])
+	}
+	return strings.Join(vals, "-")
+}
+
+func fakeRowsEqual(a, b map[string]driver.Value) bool {
+	for k, v := range a {
+		w := b[k]
+		if (v == nil) != (w == nil) {
+			return false
+		}
+		if v != nil {
+			if c, _ := fakeCompare(v, w); c != 0 || fakeIsText(v) != fakeIsText(w) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// match returns the indexes of the rows matching where, in order and limited
+func fakeMatch(s *fakeState, t *fakeTable, alias string, where fakeExpr, orderBy []fakeOrder, limit fakeExpr) ([]int, error) {
+	if alias == "" {
+		alias = t.Name
+	}
+	env := &fakeEnv{state: s, srcs: []fakeBound{{Alias: alias, Table: t}}}
+	if where != nil {
+		if _, err := where.eval(env); err != nil {
+			return nil, err
+		}
+	}
+	var idxs []int
+	for i, r := range t.rows {
+		env.srcs[0].Row = r
+		if where != nil {
+			v, err := where.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil || !fakeTruth(v) {
+				continue
+			}
+		}
+		idxs = append(idxs, i)
+	}
+	if len(orderBy) > 0 {
+		keys := make(map[int][]driver.Value, len(idxs))
+		for _, i := range idxs {
+			env.srcs[0].Row = t.rows[i]
+			for _, o := range orderBy {
+				v, err := o.Expr.eval(env)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = append(keys[i], v)
+			}
+		}
+		sort.SliceStable(idxs, func(a, b int) bool {
+			for k, o := range orderBy {
+				c, ok := fakeCompare(keys[idxs[a]][k], keys[idxs[b]][k])
+				if !ok {
+					c = fakeCmp(keys[idxs[a]][k] == nil && keys[idxs[b]][k] != nil, keys[idxs[a]][k] != nil && keys[idxs[b]][k] == nil)
+				}
+				if o.Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	n, err := fakeLimit(env, limit)
+	if err != nil {
+		return nil, err
+	}
+	if n >= 0 && n < len(idxs) {
+		idxs = idxs[:n]
+	}
+	return idxs, nil
+}
+
+func (upd *fakeUpdate) exec(s *fakeState) (driver.Result, error) {
+	t, err := s.table(upd.Table)
+	if err != nil {
+		return nil, err
+	}
+	idxs, err := fakeMatch(s, t, upd.Alias, upd.Where, upd.OrderBy, upd.Limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range upd.Sets {
+		if t.col(a.Col) == nil {
+			return nil, fmt.Errorf("fake: unknown column '%s' in 'field list'", a.Col)
+		}
+	}
+	alias := upd.Alias
+	if alias == "" {
+		alias = t.Name
+	}
+	res := &fakeResult{}
+	for _, i := range idxs {
+		updated := copyFakeRow(t.rows[i])
+		// assignments are evaluated left to right and see earlier ones, as in MySQL
+		env := &fakeEnv{state: s, srcs: []fakeBound{{Alias: alias, Table: t, Row: updated}}}
+		for _, a := range upd.Sets {
+			v, err := a.Expr.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			updated[a.Col] = t.coerce(t.col(a.Col), v)
+		}
+		if other, key := t.conflict(updated, i); other >= 0 {
+			return nil, fmt.Errorf("fake: duplicate entry '%s' for key '%s'", fakeKeyValue(t, updated, key), key)
+		}
+		if !fakeRowsEqual(t.rows[i], updated) {
+			t.rows[i] = updated
+			res.affected++
+		}
+	}
+	return res, nil
+}
+
+func (del *fakeDelete) exec(s *fakeState) (driver.Result, error) {
+	t, err := s.table(del.Table)
+	if err != nil {
+		return nil, err
+	}
+	idxs, err := fakeMatch(s, t, del.Alias, del.Where, del.OrderBy, del.Limit)
+	if err != nil {
+		return nil, err
+	}
+	drop := make(map[int]bool, len(idxs))
+	for _, i := range idxs {
+		drop[i] = true
+	}
+	rows := t.rows[:0:0]
+	for i, r := range t.rows {
+		if !drop[i] {
+			rows = append(rows, r)
+		}
+	}
+	t.rows = rows
+	return &fakeResult{affected: int64(len(idxs))}, nil
+}
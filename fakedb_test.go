@@ -0,0 +1,229 @@
+package borm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeUser struct {
+	BormLastId int64
+	ID         int64     `borm:"id"`
+	Name       string    `borm:"name"`
+	Age        int64     `borm:"age"`
+	Ctime      time.Time `borm:"ctime"`
+}
+
+func openFakeDB(t *testing.T, dsn string) *sql.DB {
+	ResetFakeDB(dsn)
+	fdb, err := sql.Open(FakeDriverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fdb.Exec("create table `t_usr` (`id` bigint unsigned not null auto_increment, `name` varchar(64) not null default '', `age` int not null default 0, `ctime` datetime, primary key (`id`), unique key `uk_name` (`name`))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fdb
+}
+
+func TestFakeDB(t *testing.T) {
+	Convey("insert and select", t, func() {
+		fdb := openFakeDB(t, "fake_insert")
+		tbl := Table(fdb, "t_usr")
+
+		o := fakeUser{Name: "Alice", Age: 18, Ctime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+		n, err := tbl.Insert(&o)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(o.BormLastId, ShouldEqual, 1)
+
+		_, err = tbl.Insert(&[]fakeUser{{Name: "Bob", Age: 20}, {Name: "Carol", Age: 30}})
+		So(err, ShouldBeNil)
+
+		var o2 fakeUser
+		n, err = tbl.Select(&o2, Where(Eq("name", "Alice")))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(o2.ID, ShouldEqual, 1)
+		So(o2.Age, ShouldEqual, 18)
+		So(o2.Ctime.Equal(o.Ctime), ShouldBeTrue)
+
+		var names []string
+		n, err = tbl.Select(&names, Fields("name"), Where(Or(In("age", 18, 30), Like("name", "B%"))), OrderBy("age desc"), Limit(2))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(names, ShouldResemble, []string{"Carol", "Bob"})
+
+		var ages []int64
+		_, err = tbl.Select(&ages, Fields("age"), Where(And(Between("age", 19, 30), Neq("name", "Carol"))))
+		So(err, ShouldBeNil)
+		So(ages, ShouldResemble, []int64{20})
+
+		var cnt int64
+		_, err = tbl.Select(&cnt, Fields("count(1)"), Where(Gte("age", 20)))
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 2)
+
+		var m []fakeUser
+		_, err = tbl.Select(&m, Where("`age` > ?", 0), Limit(1, 2))
+		So(err, ShouldBeNil)
+		So(len(m), ShouldEqual, 2)
+		So(m[0].Name, ShouldEqual, "Bob")
+	})
+
+	Convey("duplicate keys", t, func() {
+		fdb := openFakeDB(t, "fake_dup")
+		tbl := Table(fdb, "t_usr")
+
+		_, err := tbl.Insert(&fakeUser{Name: "Alice", Age: 18})
+		So(err, ShouldBeNil)
+
+		_, err = tbl.Insert(&fakeUser{Name: "Alice", Age: 19})
+		So(err, ShouldNotBeNil)
+
+		n, err := tbl.InsertIgnore(&fakeUser{Name: "Alice", Age: 19})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+
+		n, err = tbl.Insert(&fakeUser{Name: "Alice", Age: 19}, OnDuplicateKeyUpdate(V{"age": U("age+1")}))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		n, err = tbl.ReplaceInto(&fakeUser{ID: 1, Name: "Alice", Age: 30})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		var o fakeUser
+		_, err = tbl.Select(&o, Where(Eq("id", 1)))
+		So(err, ShouldBeNil)
+		So(o.Age, ShouldEqual, 30)
+	})
+
+	Convey("update and delete", t, func() {
+		fdb := openFakeDB(t, "fake_update")
+		tbl := Table(fdb, "t_usr")
+
+		_, err := tbl.Insert(&[]fakeUser{{Name: "Alice", Age: 18}, {Name: "Bob", Age: 20}, {Name: "Carol", Age: 30}})
+		So(err, ShouldBeNil)
+
+		n, err := tbl.Update(V{"age": U("age+10")}, Where(Lt("age", 25)))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+
+		n, err = tbl.Update(&fakeUser{Name: "Bob", Age: 30}, Fields("age"), Where(Eq("name", "Bob")))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 0)
+
+		n, err = tbl.Delete(Where(Eq("age", 30)), Limit(1))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+
+		var names []string
+		_, err = tbl.Select(&names, Fields("name"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"Alice", "Carol"})
+
+		_, err = tbl.Select(&names, Fields("nonexist"))
+		So(err, ShouldNotBeNil)
+
+		_, err = Table(fdb, "t_nonexist").Select(&names, Fields("name"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("transaction", t, func() {
+		fdb := openFakeDB(t, "fake_tx")
+
+		tx, err := fdb.BeginTx(context.TODO(), nil)
+		So(err, ShouldBeNil)
+		_, err = Table(tx, "t_usr").Insert(&fakeUser{Name: "Alice"})
+		So(err, ShouldBeNil)
+		So(tx.Rollback(), ShouldBeNil)
+
+		var cnt int64
+		_, err = Table(fdb, "t_usr").Select(&cnt, Fields("count(1)"))
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+
+		tx, err = fdb.BeginTx(context.TODO(), nil)
+		So(err, ShouldBeNil)
+		_, err = Table(tx, "t_usr").Insert(&fakeUser{Name: "Alice"})
+		So(err, ShouldBeNil)
+		So(tx.Commit(), ShouldBeNil)
+
+		_, err = Table(fdb, "t_usr").Select(&cnt, Fields("count(1)"))
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+	})
+
+	Convey("statements are atomic", t, func() {
+		fdb := openFakeDB(t, "fake_atomic")
+		tbl := Table(fdb, "t_usr")
+
+		_, err := tbl.Insert(&[]fakeUser{{Name: "x"}, {Name: "y"}, {Name: "x"}})
+		So(err, ShouldNotBeNil)
+
+		var cnt int64
+		_, err = tbl.Select(&cnt, Fields("count(1)"))
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 0)
+
+		_, err = tbl.Insert(&[]fakeUser{{Name: "x"}, {Name: "y"}})
+		So(err, ShouldBeNil)
+		var ids []int64
+		_, err = tbl.Select(&ids, Fields("id"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []int64{1, 2})
+
+		_, err = tbl.Update(V{"name": "x"}, Where(Gt("id", 0)))
+		So(err, ShouldNotBeNil)
+		var names []string
+		_, err = tbl.Select(&names, Fields("name"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"x", "y"})
+	})
+
+	Convey("commit keeps writes outside of the transaction", t, func() {
+		fdb := openFakeDB(t, "fake_tx_merge")
+
+		tx, err := fdb.BeginTx(context.TODO(), nil)
+		So(err, ShouldBeNil)
+		_, err = Table(tx, "t_usr").Insert(&fakeUser{Name: "Alice"})
+		So(err, ShouldBeNil)
+		_, err = Table(fdb, "t_usr").Insert(&fakeUser{Name: "Bob"})
+		So(err, ShouldBeNil)
+		So(tx.Commit(), ShouldBeNil)
+
+		var names []string
+		_, err = Table(fdb, "t_usr").Select(&names, Fields("name"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"Bob", "Alice"})
+
+		// a conflict found by the commit leaves the database unchanged
+		tx, err = fdb.BeginTx(context.TODO(), nil)
+		So(err, ShouldBeNil)
+		_, err = Table(tx, "t_usr").Insert(&fakeUser{Name: "Carol"})
+		So(err, ShouldBeNil)
+		_, err = Table(tx, "t_usr").Insert(&fakeUser{Name: "Dave"})
+		So(err, ShouldBeNil)
+		_, err = Table(fdb, "t_usr").Insert(&fakeUser{Name: "Dave"})
+		So(err, ShouldBeNil)
+		So(tx.Commit(), ShouldNotBeNil)
+
+		names = nil
+		_, err = Table(fdb, "t_usr").Select(&names, Fields("name"), OrderBy("id"))
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"Bob", "Alice", "Dave"})
+	})
+
+	Convey("undeclared tables", t, func() {
+		fdb := openFakeDB(t, "fake_undeclared")
+
+		_, err := Table(fdb, "t_any").Insert(V{"k": "a", "v": 1})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "fake: table 't_any' doesn't exist")
+	})
+}
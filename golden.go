@@ -0,0 +1,209 @@
+/*
+   borm is a better orm library for Go.
+
+  Copyright (c) 2019 <http://ez8.co> <orca.zhang@yahoo.com>
+
+  This library is released under the MIT License.
+  Please see LICENSE file or visit https://github.com/orca-zhang/borm for details.
+*/
+
+package borm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+   Golden-file SQL snapshots
+
+      func TestUserRepo(t *testing.T) {
+         b.BormGolden(t, "user_repo", func(db b.BormDBIFace) {
+            NewUserRepo(db).FindByName("orca")
+         })
+      }
+
+   The SQL and args of every statement are compared with testdata/user_repo.golden,
+   run `BORM_UPDATE_GOLDEN=1 go test` to regenerate it.
+*/
+
+// updateGolden reports whether golden files should be regenerated, an env var rather than a flag
+// so that the test binaries of packages importing borm are free to define their own flags
+func updateGolden() bool {
+	v := os.Getenv("BORM_UPDATE_GOLDEN")
+	return v != "" && v != "0" && v != "false"
+}
+
+// BormTB is the subset of testing.TB used by BormGolden
+type BormTB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// BormStmt is a statement recorded by BormCapture
+type BormStmt struct {
+	SQL  string
+	Args []interface{}
+}
+
+// String formats the statement with its args resolved the way the driver receives them
+func (s BormStmt) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.SQL)
+	sb.WriteString("\n[")
+	for i, a := range s.Args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(formatGoldenArg(a))
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// BormCapture is a BormDBIFace recording every statement before passing it to DB
+type BormCapture struct {
+	DB    BormDBIFace
+	mu    sync.Mutex
+	stmts []BormStmt
+}
+
+var _captureSeq int64
+
+// NewBormCapture wraps db, or a fresh in-memory fake database if db is nil
+func NewBormCapture(db BormDBIFace) *BormCapture {
+	if db == nil {
+		dsn := "borm_capture_" + strconv.FormatInt(atomic.AddInt64(&_captureSeq, 1), 10)
+		fdb, _ := sql.Open(FakeDriverName, dsn)
+		db = fdb
+	}
+	return &BormCapture{DB: db}
+}
+
+// Stmts returns the statements recorded so far
+func (c *BormCapture) Stmts() []BormStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]BormStmt(nil), c.stmts...)
+}
+
+// Last returns the last statement recorded, a zero BormStmt if none
+func (c *BormCapture) Last() BormStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.stmts) <= 0 {
+		return BormStmt{}
+	}
+	return c.stmts[len(c.stmts)-1]
+}
+
+func (c *BormCapture) record(query string, args []interface{}) {
+	c.mu.Lock()
+	c.stmts = append(c.stmts, BormStmt{SQL: query, Args: append([]interface{}(nil), args...)})
+	c.mu.Unlock()
+}
+
+// QueryRowContext .
+func (c *BormCapture) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c.record(query, args)
+	return c.DB.QueryRowContext(ctx, query, args...)
+}
+
+// QueryContext .
+func (c *BormCapture) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.record(query, args)
+	return c.DB.QueryContext(ctx, query, args...)
+}
+
+// ExecContext .
+func (c *BormCapture) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c.record(query, args)
+	return c.DB.ExecContext(ctx, query, args...)
+}
+
+func formatGoldenArg(a interface{}) string {
+	v, err := driver.DefaultParameterConverter.ConvertValue(a)
+	if err != nil {
+		return fmt.Sprintf("%T(%v)", a, a)
+	}
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(x)
+	case []byte:
+		return "x" + strconv.Quote(string(x))
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// ClearReuseCache drops all SQL cached by the Reuse feature. The cache is shared by all tables
+// and databases of the process, so it is meant for tests, like BormGolden
+func ClearReuseCache() {
+	_dataBindingCache.Range(func(k, _ interface{}) bool {
+		_dataBindingCache.Delete(k)
+		return true
+	})
+}
+
+func formatGolden(stmts []BormStmt) string {
+	var sb strings.Builder
+	for i, s := range stmts {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(s.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// BormGolden runs f against a capturing in-memory database and compares the SQL it
+// generates with testdata/<name>.golden, f is run a second time to check that
+// executions served from the reuse cache generate the same SQL
+func BormGolden(tb BormTB, name string, f func(db BormDBIFace)) {
+	tb.Helper()
+
+	ClearReuseCache()
+	uncached := NewBormCapture(nil)
+	f(uncached)
+	cached := NewBormCapture(nil)
+	f(cached)
+
+	got := formatGolden(uncached.Stmts())
+	if again := formatGolden(cached.Stmts()); again != got {
+		tb.Errorf("borm golden %s: cached execution differs from uncached one\n--- uncached\n%s--- cached\n%s", name, got, again)
+	}
+
+	file := filepath.Join("testdata", name+".golden")
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			tb.Fatalf("borm golden %s: %v", name, err)
+		}
+		if err := os.WriteFile(file, []byte(got), 0o644); err != nil {
+			tb.Fatalf("borm golden %s: %v", name, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(file)
+	if err != nil {
+		tb.Fatalf("borm golden %s: %v (run with BORM_UPDATE_GOLDEN=1 to create it)", name, err)
+		return
+	}
+	if string(want) != got {
+		tb.Errorf("borm golden %s: SQL differs from %s (run with BORM_UPDATE_GOLDEN=1 to accept)\n--- want\n%s--- got\n%s", name, file, want, got)
+	}
+}
@@ -0,0 +1,144 @@
+package borm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type goldenTB struct {
+	errs []string
+}
+
+func (g *goldenTB) Helper() {}
+func (g *goldenTB) Errorf(format string, args ...interface{}) {
+	g.errs = append(g.errs, fmt.Sprintf(format, args...))
+}
+func (g *goldenTB) Fatalf(format string, args ...interface{}) {
+	g.errs = append(g.errs, fmt.Sprintf(format, args...))
+}
+
+// captureTable opens the fake database dsn with the t_usr table, runs ddl on it and returns the table name behind a capture
+func captureTable(t *testing.T, dsn, name string, ddl ...string) (*BormCapture, *BormTable) {
+	fdb := openFakeDB(t, dsn)
+	for _, stmt := range ddl {
+		if _, err := fdb.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewBormCapture(fdb)
+	return c, Table(c, name)
+}
+
+func goldenUserRepo(db BormDBIFace) {
+	db.ExecContext(context.TODO(), "create table `t_usr` (`id` bigint auto_increment primary key, `name` varchar(64), `age` int, `ctime` datetime)")
+
+	tbl := Table(db, "t_usr")
+	tbl.Insert(&fakeUser{Name: "orca", Age: 29, Ctime: time.Date(2019, 3, 1, 2, 3, 4, 0, time.UTC)})
+	tbl.Insert(V{"name": "zhang", "age": 30})
+
+	var o fakeUser
+	tbl.Select(&o, Where(Eq("name", "orca"), In("age", 29, 30)), Limit(1))
+
+	var names []string
+	tbl.Select(&names, Fields("name"), Where(Gte("age", 18)), OrderBy("id desc"))
+
+	tbl.Update(V{"age": U("age+1")}, Where(Eq("id", 1)))
+	tbl.Delete(Where(Lt("age", 18)))
+}
+
+func TestBormGolden(t *testing.T) {
+	Convey("golden file matches", t, func() {
+		BormGolden(t, "user_repo", goldenUserRepo)
+	})
+
+	Convey("capture records statements", t, func() {
+		c := NewBormCapture(nil)
+		goldenUserRepo(c)
+
+		stmts := c.Stmts()
+		So(len(stmts), ShouldEqual, 7)
+		So(stmts[3].SQL, ShouldEqual, "select `id`,`name`,`age`,`ctime` from `t_usr` where `name`=? and `age` in (?,?) limit ?")
+		So(stmts[3].String(), ShouldEndWith, "\n[\"orca\", 29, 30, 1]")
+		So(c.Last(), ShouldResemble, stmts[6])
+	})
+
+	if updateGolden() {
+		return
+	}
+
+	Convey("mismatch is reported", t, func() {
+		g := &goldenTB{}
+		BormGolden(g, "user_repo", func(db BormDBIFace) {
+			var o fakeUser
+			Table(db, "t_usr").Select(&o, Where(Eq("name", "orca")))
+		})
+		So(len(g.errs), ShouldEqual, 1)
+		So(g.errs[0], ShouldContainSubstring, "SQL differs")
+
+		g = &goldenTB{}
+		BormGolden(g, "nonexist", goldenUserRepo)
+		So(len(g.errs), ShouldEqual, 1)
+		So(g.errs[0], ShouldContainSubstring, "BORM_UPDATE_GOLDEN=1")
+	})
+
+	Convey("second execution is served from the reuse cache", t, func() {
+		ClearReuseCache()
+		goldenUserRepo(NewBormCapture(nil))
+		_dataBindingCache.Range(func(_, v interface{}) bool {
+			item := v.(*DataBindingItem)
+			item.SQL = "/* cached */ " + item.SQL
+			return true
+		})
+		defer ClearReuseCache()
+
+		c := NewBormCapture(nil)
+		goldenUserRepo(c)
+		stmts := c.Stmts()
+		// the insert of a struct, the selects and the delete, maps are not cached
+		for _, i := range []int{1, 3, 4, 6} {
+			So(stmts[i].SQL, ShouldStartWith, "/* cached */ ")
+		}
+		So(stmts[2].SQL, ShouldNotStartWith, "/* cached */ ")
+	})
+
+	Convey("cached selects scan into the new result", t, func() {
+		c, tbl := captureTable(t, "fake_golden_reuse", "t_usr")
+		_, err := tbl.Insert(&[]fakeUser{{Name: "a", Age: 1}, {Name: "b", Age: 2}})
+		So(err, ShouldBeNil)
+
+		var got []fakeUser
+		for _, name := range []string{"a", "b"} {
+			var o fakeUser
+			n, err := tbl.Select(&o, Where(Eq("name", name)))
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			got = append(got, o)
+		}
+		So(got[0].Age, ShouldEqual, 1)
+		So(got[1].Age, ShouldEqual, 2)
+
+		for _, age := range []int{1, 2} {
+			var names []string
+			_, err := tbl.Select(&names, Fields("name"), Where(Eq("age", age)))
+			So(err, ShouldBeNil)
+			So(names, ShouldHaveLength, 1)
+		}
+		So(len(c.Stmts()), ShouldEqual, 5)
+	})
+
+	Convey("cached execution differs", t, func() {
+		g := &goldenTB{}
+		n := 0
+		BormGolden(g, "user_repo", func(db BormDBIFace) {
+			n++
+			var o fakeUser
+			Table(db, "t_usr").Select(&o, Where(Eq("id", n)), Limit(n))
+		})
+		So(len(g.errs), ShouldBeGreaterThanOrEqualTo, 1)
+		So(g.errs[0], ShouldContainSubstring, "cached execution differs")
+	})
+}